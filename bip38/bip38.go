@@ -0,0 +1,396 @@
+/*
+Package bip38 handles passphrase-encrypted private keys (BIP38)
+
+- Encrypt encrypts a WIF without EC multiplication
+- NewIntermediate generates an intermediate code from a passphrase for EC multiplication
+- NewEncryptedKey generates a new encrypted key from an intermediate code without the passphrase
+- Decrypt decrypts keys encrypted in either mode into WIFs
+*/
+package bip38
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Prefixes and flags of encrypted keys and intermediate codes.
+const (
+	prefixNonECMultiplied = 0x42
+	prefixECMultiplied    = 0x43
+
+	flagNonECMultiplied = 0xc0
+	flagCompressed      = 0x20
+	flagLotSequence     = 0x04
+
+	encryptedKeyLen = 39
+	intermediateLen = 49
+
+	// MaxLot and MaxSequence are the upper limits of lot and sequence numbers in EC multiplication.
+	MaxLot      = 1<<20 - 1
+	MaxSequence = 1<<12 - 1
+)
+
+var (
+	intermediateMagic            = []byte{0x2c, 0xe9, 0xb3, 0xe1, 0xff, 0x39, 0xe2, 0x53}
+	intermediateMagicLotSequence = []byte{0x2c, 0xe9, 0xb3, 0xe1, 0xff, 0x39, 0xe2, 0x51}
+)
+
+var (
+	errInvalidKey          = errors.New("the key is not a BIP38 encrypted key")
+	errInvalidIntermediate = errors.New("the code is not a BIP38 intermediate code")
+	errWrongPassphrase     = errors.New("the passphrase is wrong")
+	errLotSequence         = errors.New("the lot or the sequence number is out of range")
+)
+
+// IsEncrypted tells whether the string looks like a BIP38 encrypted key.
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, "6P")
+}
+
+// Encrypt encrypts the WIF with the passphrase without EC multiplication.
+// The address hash is calculated with the P2PKH address on the network of the WIF.
+func Encrypt(wif *btcutil.WIF, passphrase string, net *chaincfg.Params) (string, error) {
+	flag := byte(flagNonECMultiplied)
+	if wif.CompressPubKey {
+		flag |= flagCompressed
+	}
+
+	addrHash, err := addressHash(wif.SerializePubKey(), net)
+	if err != nil {
+		return "", err
+	}
+
+	derived, err := scrypt.Key(normalize(passphrase), addrHash, 16384, 8, 8, 64)
+	if err != nil {
+		return "", fmt.Errorf("couldn't derive the key from the passphrase: %w", err)
+	}
+
+	privKey := wif.PrivKey.Serialize()
+	encrypted := make([]byte, 32)
+
+	if err := encryptBlocks(encrypted, xor(privKey, derived[:32]), derived[32:]); err != nil {
+		return "", err
+	}
+
+	return encode([]byte{0x01, prefixNonECMultiplied, flag}, addrHash, encrypted), nil
+}
+
+// NewIntermediate generates an intermediate code from the passphrase with the owner salt read from r.
+// The lot and the sequence numbers are included if lotSequence is true.
+func NewIntermediate(r io.Reader, passphrase string, lotSequence bool, lot, sequence uint32) (string, error) {
+	if lotSequence && (lot > MaxLot || sequence > MaxSequence) {
+		return "", errLotSequence
+	}
+
+	ownerSalt := make([]byte, 8)
+	if lotSequence {
+		ownerSalt = ownerSalt[:4]
+	}
+
+	if _, err := io.ReadFull(r, ownerSalt); err != nil {
+		return "", fmt.Errorf("couldn't read the owner salt: %w", err)
+	}
+
+	ownerEntropy := ownerSalt
+	magic := intermediateMagic
+
+	if lotSequence {
+		ls := lot<<12 | sequence
+		ownerEntropy = append(ownerSalt, byte(ls>>24), byte(ls>>16), byte(ls>>8), byte(ls))
+		magic = intermediateMagicLotSequence
+	}
+
+	passFactor, err := passFactor(passphrase, ownerEntropy, lotSequence)
+	if err != nil {
+		return "", err
+	}
+
+	_, passPoint := btcec.PrivKeyFromBytes(passFactor)
+
+	return encode(magic, ownerEntropy, passPoint.SerializeCompressed()), nil
+}
+
+// NewEncryptedKey generates a new encrypted key and its P2PKH address on the network
+// from the intermediate code with the seed read from r, without knowing the passphrase.
+func NewEncryptedKey(r io.Reader, intermediate string, compress bool, net *chaincfg.Params) (string, string, error) {
+	payload, err := decode(intermediate, intermediateLen)
+	if err != nil {
+		return "", "", errInvalidIntermediate
+	}
+
+	flag := byte(0)
+
+	switch {
+	case bytes.Equal(payload[:8], intermediateMagic):
+	case bytes.Equal(payload[:8], intermediateMagicLotSequence):
+		flag |= flagLotSequence
+	default:
+		return "", "", errInvalidIntermediate
+	}
+
+	if compress {
+		flag |= flagCompressed
+	}
+
+	ownerEntropy := payload[8:16]
+
+	passPoint, err := btcec.ParsePubKey(payload[16:])
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't parse the passpoint: %w", err)
+	}
+
+	seedB := make([]byte, 24)
+	if _, err := io.ReadFull(r, seedB); err != nil {
+		return "", "", fmt.Errorf("couldn't read the seed: %w", err)
+	}
+
+	var factorB, point btcec.JacobianPoint
+
+	passPoint.AsJacobian(&point)
+
+	var k btcec.ModNScalar
+	k.SetByteSlice(chainhash.DoubleHashB(seedB))
+	btcec.ScalarMultNonConst(&k, &point, &factorB)
+	factorB.ToAffine()
+
+	generated := btcec.NewPublicKey(&factorB.X, &factorB.Y)
+
+	pubKey := generated.SerializeUncompressed()
+	if compress {
+		pubKey = generated.SerializeCompressed()
+	}
+
+	addrHash, err := addressHash(pubKey, net)
+	if err != nil {
+		return "", "", err
+	}
+
+	derived, err := scrypt.Key(passPoint.SerializeCompressed(), append(append([]byte{}, addrHash...), ownerEntropy...), 1024, 1, 1, 64)
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't derive the key from the passpoint: %w", err)
+	}
+
+	encryptedPart1 := make([]byte, 16)
+	if err := encryptBlocks(encryptedPart1, xor(seedB[:16], derived[:16]), derived[32:]); err != nil {
+		return "", "", err
+	}
+
+	encryptedPart2 := make([]byte, 16)
+	if err := encryptBlocks(encryptedPart2, xor(append(encryptedPart1[8:16:16], seedB[16:]...), derived[16:32]), derived[32:]); err != nil {
+		return "", "", err
+	}
+
+	addr, err := btcutil.NewAddressPubKey(pubKey, net)
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't generate an address: %w", err)
+	}
+
+	key := encode([]byte{0x01, prefixECMultiplied, flag}, addrHash, ownerEntropy, encryptedPart1[:8], encryptedPart2)
+
+	return key, addr.EncodeAddress(), nil
+}
+
+// Decrypt decrypts the encrypted key with the passphrase into the WIF on the network.
+func Decrypt(encrypted, passphrase string, net *chaincfg.Params) (*btcutil.WIF, error) {
+	payload, err := decode(encrypted, encryptedKeyLen)
+	if err != nil || payload[0] != 0x01 {
+		return nil, errInvalidKey
+	}
+
+	flag := payload[2]
+	compress := flag&flagCompressed != 0
+	addrHash := payload[3:7]
+
+	var privKey *btcec.PrivateKey
+
+	switch payload[1] {
+	case prefixNonECMultiplied:
+		privKey, err = decryptNonECMultiplied(payload, passphrase)
+	case prefixECMultiplied:
+		privKey, err = decryptECMultiplied(payload, passphrase)
+	default:
+		return nil, errInvalidKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	wif, err := btcutil.NewWIF(privKey, net, compress)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create a wif key: %w", err)
+	}
+
+	// The address hash tells whether the passphrase is correct
+	h, err := addressHash(wif.SerializePubKey(), net)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(h, addrHash) {
+		return nil, errWrongPassphrase
+	}
+
+	return wif, nil
+}
+
+func decryptNonECMultiplied(payload []byte, passphrase string) (*btcec.PrivateKey, error) {
+	derived, err := scrypt.Key(normalize(passphrase), payload[3:7], 16384, 8, 8, 64)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't derive the key from the passphrase: %w", err)
+	}
+
+	decrypted := make([]byte, 32)
+	if err := decryptBlocks(decrypted, payload[7:], derived[32:]); err != nil {
+		return nil, err
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(xor(decrypted, derived[:32]))
+
+	return privKey, nil
+}
+
+func decryptECMultiplied(payload []byte, passphrase string) (*btcec.PrivateKey, error) {
+	lotSequence := payload[2]&flagLotSequence != 0
+	addrHash := payload[3:7]
+	ownerEntropy := payload[7:15]
+
+	passFactor, err := passFactor(passphrase, ownerEntropy, lotSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	_, passPoint := btcec.PrivKeyFromBytes(passFactor)
+
+	derived, err := scrypt.Key(passPoint.SerializeCompressed(), append(append([]byte{}, addrHash...), ownerEntropy...), 1024, 1, 1, 64)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't derive the key from the passpoint: %w", err)
+	}
+
+	// encryptedpart2 has the latter half of encryptedpart1 and the rest of seedb
+	decrypted2 := make([]byte, 16)
+	if err := decryptBlocks(decrypted2, payload[23:39], derived[32:]); err != nil {
+		return nil, err
+	}
+
+	decrypted2 = xor(decrypted2, derived[16:32])
+	encryptedPart1 := append(append([]byte{}, payload[15:23]...), decrypted2[:8]...)
+
+	decrypted1 := make([]byte, 16)
+	if err := decryptBlocks(decrypted1, encryptedPart1, derived[32:]); err != nil {
+		return nil, err
+	}
+
+	seedB := append(xor(decrypted1, derived[:16]), decrypted2[8:]...)
+
+	var k, factorB btcec.ModNScalar
+	k.SetByteSlice(passFactor)
+	factorB.SetByteSlice(chainhash.DoubleHashB(seedB))
+	k.Mul(&factorB)
+
+	return btcec.PrivKeyFromScalar(&k), nil
+}
+
+// normalize returns the passphrase in UTF-8 normalized to NFC as BIP38 requires,
+// so that the same passphrase typed in different forms derives the same key.
+func normalize(passphrase string) []byte {
+	return []byte(norm.NFC.String(passphrase))
+}
+
+// passFactor derives the passfactor from the passphrase and the owner entropy.
+func passFactor(passphrase string, ownerEntropy []byte, lotSequence bool) ([]byte, error) {
+	ownerSalt := ownerEntropy
+	if lotSequence {
+		ownerSalt = ownerEntropy[:4]
+	}
+
+	preFactor, err := scrypt.Key(normalize(passphrase), ownerSalt, 16384, 8, 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't derive the key from the passphrase: %w", err)
+	}
+
+	if !lotSequence {
+		return preFactor, nil
+	}
+
+	return chainhash.DoubleHashB(append(preFactor, ownerEntropy...)), nil
+}
+
+// addressHash returns the first 4 bytes of the double SHA256 of the P2PKH address of the public key.
+func addressHash(pubKey []byte, net *chaincfg.Params) ([]byte, error) {
+	addr, err := btcutil.NewAddressPubKey(pubKey, net)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate an address: %w", err)
+	}
+
+	return chainhash.DoubleHashB([]byte(addr.EncodeAddress()))[:4], nil
+}
+
+func encryptBlocks(dst, src, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("couldn't initialize AES: %w", err)
+	}
+
+	for i := 0; i < len(src); i += aes.BlockSize {
+		block.Encrypt(dst[i:i+aes.BlockSize], src[i:i+aes.BlockSize])
+	}
+
+	return nil
+}
+
+func decryptBlocks(dst, src, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("couldn't initialize AES: %w", err)
+	}
+
+	for i := 0; i < len(src); i += aes.BlockSize {
+		block.Decrypt(dst[i:i+aes.BlockSize], src[i:i+aes.BlockSize])
+	}
+
+	return nil
+}
+
+func xor(a, b []byte) []byte {
+	x := make([]byte, len(a))
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+
+	return x
+}
+
+// encode concatenates the parts and encodes them in base58 with the checksum.
+func encode(parts ...[]byte) string {
+	payload := bytes.Join(parts, nil)
+
+	return base58.Encode(append(payload, chainhash.DoubleHashB(payload)[:4]...))
+}
+
+// decode decodes the base58 string with the checksum into the payload of the length.
+func decode(s string, length int) ([]byte, error) {
+	b := base58.Decode(s)
+	if len(b) != length+4 {
+		return nil, errInvalidKey
+	}
+
+	payload, checksum := b[:length], b[length:]
+	if !bytes.Equal(chainhash.DoubleHashB(payload)[:4], checksum) {
+		return nil, errInvalidKey
+	}
+
+	return payload, nil
+}
@@ -1,46 +1,198 @@
 /*
-Package bs will be CLI to access to blockstream TestNet3
+Package bs will be CLI to access to blockstream (Esplora) APIs
+
+Client accesses the API of blockstream.info (mempool.space for signet) by default,
+and another one such as a self-hosted electrs with its BaseURL or the environment variable MYBTC_ESPLORA_URL.
+The UTXO of addresses with long history is reconstructed by walking the pages of their transactions.
+Calls rate limited or failed by the server are retried with exponential backoff, and the errors of the API are typed by the status.
 */
 package bs
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
 )
 
-// TxStatus expresses the status of the transaction.
-type TxStatus struct {
-	Confirmed   bool   `json:"confirmed"`
-	BlockHeight int64  `json:"block_height"`
-	BlockHash   string `json:"block_hash"`
-	BlockTime   uint64 `json:"block_time"`
+var (
+	errAddrNetwork  = errors.New("the address is not for the network")
+	errRejected     = errors.New("the transaction was rejected")
+	errInconsistent = errors.New("the responses are inconsistent")
+)
+
+// APIURLEnv is the name of the environment variable to give the base URL of the Esplora API instead of the default one.
+const APIURLEnv = "MYBTC_ESPLORA_URL"
+
+// DefaultTimeout is the default time limit of each call.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultUserAgent is sent as the User-Agent header by default.
+const DefaultUserAgent = "mybtc"
+
+// DefaultRetries is the default number of retries when the API is rate limited or fails by itself.
+const DefaultRetries = 3
+
+// DefaultBackoff is the default wait before the first retry, which doubles at every retry.
+const DefaultBackoff = time.Second
+
+// DefaultConcurrency is the default number of calls at once to retrieve transactions.
+const DefaultConcurrency = 4
+
+// DefaultRate is the default limit of calls per second, which is far below the limit of blockstream.info.
+const DefaultRate = 10
+
+// Client accesses an Esplora API such as blockstream.info, mempool.space or a self-hosted electrs.
+type Client struct {
+	// BaseURL is the base URL of the API without the trailing slash, e.g. https://blockstream.info/testnet/api.
+	BaseURL string
+	// Net is the network of the addresses and the transactions.
+	Net *chaincfg.Params
+	// HTTPClient sends the requests, and http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+	// Timeout limits each call in addition to the deadline of the context if it is positive.
+	Timeout time.Duration
+	// UserAgent is sent as the User-Agent header if it is not empty.
+	UserAgent string
+	// Concurrency is the number of calls at once to retrieve transactions, and they are serial if it is below 2.
+	Concurrency int
+	// Limiter limits the rate of all the calls if it is not nil.
+	Limiter *Limiter
+	// Retries is the number of retries for the responses of 429 and 5xx.
+	Retries int
+	// Backoff is the wait before the first retry, and Retry-After of the response is honored if it is longer.
+	Backoff time.Duration
+	// Cache keeps confirmed transactions retrieved by GetTx if it is not nil.
+	Cache *Cache
 }
 
-// UTXO expresses an unspent transaction output.
-type UTXO struct {
-	TxID   string   `json:"txid"`
-	Idx    uint32   `json:"vout"`
-	Status TxStatus `json:"status"`
-	Value  uint64   `json:"value"`
+// NewClient returns a client of the default API for the network, which is overridden by APIURLEnv.
+func NewClient(net *chaincfg.Params) (*Client, error) {
+	base, err := apiURL(net)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		BaseURL:     base,
+		Net:         net,
+		Timeout:     DefaultTimeout,
+		UserAgent:   DefaultUserAgent,
+		Concurrency: DefaultConcurrency,
+		Limiter:     NewLimiter(DefaultRate, DefaultConcurrency),
+		Retries:     DefaultRetries,
+		Backoff:     DefaultBackoff,
+	}, nil
 }
 
-// GetUTXO retrieves a list of UTXO of the given address.
-func GetUTXO(a string) ([]UTXO, error) {
-	target := fmt.Sprintf("https://blockstream.info/testnet/api/address/%s/utxo", a)
+// apiURL returns the base URL of the Esplora API for the network, which is overridden by APIURLEnv.
+// Regtest is assumed to be served by a local electrs.
+func apiURL(net *chaincfg.Params) (string, error) {
+	if u := os.Getenv(APIURLEnv); u != "" {
+		return strings.TrimSuffix(u, "/"), nil
+	}
+
+	switch net.Name {
+	case chaincfg.MainNetParams.Name:
+		return "https://blockstream.info/api", nil
+	case chaincfg.TestNet3Params.Name:
+		return "https://blockstream.info/testnet/api", nil
+	case chaincfg.SigNetParams.Name:
+		return "https://mempool.space/signet/api", nil
+	case chaincfg.RegressionNetParams.Name:
+		return "http://localhost:3002", nil
+	default:
+		return "", fmt.Errorf("no API for the network: %s", net.Name)
+	}
+}
+
+// do sends the request to the path under the base URL, and returns the body of the response.
+// It retries with exponential backoff while the API is rate limited or fails by itself,
+// and the error is one of the types in errors.go if the status code is not 200.
+func (c *Client) do(ctx context.Context, method, path, body string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		b, err := c.doOnce(ctx, method, path, body)
+
+		var (
+			rateLimited *RateLimitedError
+			serverError *ServerError
+			wait        time.Duration
+		)
+
+		switch {
+		case errors.As(err, &rateLimited):
+			wait = rateLimited.RetryAfter
+		case errors.As(err, &serverError):
+		default:
+			return b, err
+		}
+
+		if attempt >= c.Retries {
+			return nil, err
+		}
+
+		if backoff := c.Backoff << attempt; wait < backoff {
+			wait = backoff
+		}
 
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target, http.NoBody)
+		if waitErr := sleep(ctx, wait); waitErr != nil {
+			return nil, fmt.Errorf("%w (gave up retrying: %s)", err, waitErr)
+		}
+	}
+}
+
+// doOnce sends the request once within the timeout.
+func (c *Client) doOnce(ctx context.Context, method, path, body string) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	if err := c.Limiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("couldn't wait for the rate limit: %w", err)
+	}
+
+	target := strings.TrimSuffix(c.BaseURL, "/") + path
+
+	var r io.Reader = http.NoBody
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, r)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't build an HTTP request to '%s': %w", target, err)
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	if body != "" {
+		req.Header.Set("Content-Type", "text/plain")
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	res, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get UTXO about %s: %w", a, err)
+		return nil, fmt.Errorf("HTTP request to '%s' failed: %w", target, err)
 	}
+
 	//nolint:errcheck // nothing to do at error
 	defer res.Body.Close()
 
@@ -50,7 +202,46 @@ func GetUTXO(a string) ([]UTXO, error) {
 	}
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP request for %s failed: code: %d, body: %s", a, res.StatusCode, b)
+		return nil, newStatusError(path, res, b)
+	}
+
+	return b, nil
+}
+
+// sleep waits for the duration or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// TxStatus expresses the status of the transaction.
+type TxStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight int64  `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+	BlockTime   uint64 `json:"block_time"`
+}
+
+// UTXO expresses an unspent transaction output.
+type UTXO struct {
+	TxID   string   `json:"txid"`
+	Idx    uint32   `json:"vout"`
+	Status TxStatus `json:"status"`
+	Value  uint64   `json:"value"`
+}
+
+// GetUTXO retrieves a list of UTXO of the given address.
+func (c *Client) GetUTXO(ctx context.Context, a string) ([]UTXO, error) {
+	b, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/address/%s/utxo", a), "")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get UTXO about %s: %w", a, err)
 	}
 
 	us := []UTXO{}
@@ -89,75 +280,183 @@ type Tx struct {
 }
 
 // GetTx retrieves transaction data associated with the given transaction ID.
-func GetTx(txid string) (*Tx, error) {
-	target := fmt.Sprintf("https://blockstream.info/testnet/api/tx/%s", txid)
-
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target, http.NoBody)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't build an HTTP request to '%s': %w", target, err)
+// Confirmed transactions are taken from and kept in the cache, and failing to keep them is not an error.
+func (c *Client) GetTx(ctx context.Context, txid string) (*Tx, error) {
+	if tx, ok := c.Cache.Get(txid); ok {
+		return tx, nil
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	b, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/tx/%s", txid), "")
 	if err != nil {
 		return nil, fmt.Errorf("couldn't get Tx of %s: %w", txid, err)
 	}
 
-	//nolint:errcheck // nothing to do at error
-	defer res.Body.Close()
+	tx := &Tx{}
+	if err := json.Unmarshal(b, tx); err != nil {
+		return nil, fmt.Errorf("could't parse retrieved UTXO output: %w", err)
+	}
+
+	if tx.TxID != txid {
+		return nil, fmt.Errorf("%w: %s returned for %s", errInconsistent, tx.TxID, txid)
+	}
+
+	//nolint:errcheck // the cache only saves calls, and the transaction is retrieved anyway
+	c.Cache.Put(tx)
+
+	return tx, nil
+}
+
+// Broadcast submits the raw transaction in hex to the network, and returns its txid.
+// The reason is returned as the error if the transaction is rejected.
+func (c *Client) Broadcast(ctx context.Context, rawTx string) (string, error) {
+	b, err := c.do(ctx, http.MethodPost, "/tx", strings.TrimSpace(rawTx))
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusBadRequest {
+		return "", fmt.Errorf("%w: %s", errRejected, rejectReason(statusErr.Body))
+	}
 
-	b, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't read body of the response: %w", err)
+		return "", fmt.Errorf("couldn't broadcast the transaction: %w", err)
 	}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP request for %s failed: code: %d, body: %s", txid, res.StatusCode, b)
+	return strings.TrimSpace(string(b)), nil
+}
+
+// rejectReason extracts the message from the rejection of Esplora such as
+// sendrawtransaction RPC error: {"code":-26,"message":"min relay fee not met, 100 < 141"}
+func rejectReason(body string) string {
+	reason := strings.TrimSpace(body)
+
+	i := strings.Index(reason, "{")
+	if i < 0 {
+		return reason
 	}
 
-	tx := &Tx{}
-	if err := json.Unmarshal(b, tx); err != nil {
-		return nil, fmt.Errorf("could't parse retrieved UTXO output: %w", err)
+	var rpcErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
 	}
 
-	return tx, nil
+	if err := json.Unmarshal([]byte(reason[i:]), &rpcErr); err != nil || rpcErr.Message == "" {
+		return reason
+	}
+
+	return fmt.Sprintf("%s (code %d)", rpcErr.Message, rpcErr.Code)
+}
+
+// GetTipHeight retrieves the height of the last block.
+func (c *Client) GetTipHeight(ctx context.Context) (int64, error) {
+	b, err := c.do(ctx, http.MethodGet, "/blocks/tip/height", "")
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get the tip height: %w", err)
+	}
+
+	height, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't parse the tip height: %w", err)
+	}
+
+	return height, nil
 }
 
 // VinSummary expresses a summary of Vin.
+// Status is the status of the transaction of the output.
 type VinSummary struct {
-	TxID         string `json:"txid"`
-	Vout         uint32 `json:"vout"`
-	ScriptPubKey string `json:"scriptpubkey"`
-	Value        uint64 `json:"value"`
+	TxID         string   `json:"txid"`
+	Vout         uint32   `json:"vout"`
+	ScriptPubKey string   `json:"scriptpubkey"`
+	Value        uint64   `json:"value"`
+	Status       TxStatus `json:"status"`
 }
 
-// GetUTXOWithScriptPubKey returns a list of summary of UTXO with ScriptPubKey.
-func GetUTXOWithScriptPubKey(a string) ([]VinSummary, error) {
-	utxos, err := GetUTXO(a)
+// GetUTXOWithScriptPubKey returns a list of summary of UTXO with ScriptPubKey of the address.
+// The UTXO is reconstructed from the history of the address if it has too many history entries for the UTXO endpoint.
+func (c *Client) GetUTXOWithScriptPubKey(ctx context.Context, a string) ([]VinSummary, error) {
+	addr, err := btcutil.DecodeAddress(a, c.Net)
 	if err != nil {
-		log.Fatalf("%s", err)
+		return nil, fmt.Errorf("couldn't decode given address '%s': %w", a, err)
+	}
+
+	if !addr.IsForNet(c.Net) {
+		return nil, fmt.Errorf("%w: '%s' for %s", errAddrNetwork, a, c.Net.Name)
+	}
+
+	utxos, err := c.GetUTXO(ctx, a)
+
+	var tooMany *TooManyHistoryError
+	if errors.As(err, &tooMany) {
+		return c.GetUTXOFromHistory(ctx, a)
 	}
 
-	// Initialize the output
-	vinInput := []VinSummary{}
+	if err != nil {
+		return nil, err
+	}
 
-	// Fulfill vinInput
+	txids := make([]string, 0, len(utxos))
 	for _, utxo := range utxos {
-		tx, err := GetTx(utxo.TxID)
-		if err != nil {
-			return nil, fmt.Errorf("couldn't get tx of %s: %w", utxo.TxID, err)
-		}
+		txids = append(txids, utxo.TxID)
+	}
+
+	txs, err := c.GetTxs(ctx, txids)
+	if err != nil {
+		return nil, err
+	}
 
-		for i, vout := range tx.Vout {
-			if vout.ScriptPubKeyAddress == a {
-				vinInput = append(vinInput, VinSummary{
-					TxID:         tx.TxID,
-					Vout:         uint32(i),
-					ScriptPubKey: vout.ScriptPubKey,
-					Value:        vout.Value,
-				})
-			}
+	byTxID := map[string]*Tx{}
+	for _, tx := range txs {
+		byTxID[tx.TxID] = tx
+	}
+
+	// Only the outputs in the UTXO are summarized, not the spent ones to the same address in the same transactions
+	vinInput := make([]VinSummary, 0, len(utxos))
+
+	for _, utxo := range utxos {
+		tx := byTxID[utxo.TxID]
+		if tx == nil || int(utxo.Idx) >= len(tx.Vout) {
+			return nil, fmt.Errorf("%w: no output %d in %s", errInconsistent, utxo.Idx, utxo.TxID)
 		}
+
+		vinInput = append(vinInput, VinSummary{
+			TxID:         utxo.TxID,
+			Vout:         utxo.Idx,
+			ScriptPubKey: tx.Vout[utxo.Idx].ScriptPubKey,
+			Value:        utxo.Value,
+			Status:       utxo.Status,
+		})
 	}
 
 	return vinInput, nil
 }
+
+// GetTxs retrieves the transactions concurrently, and returns them in the order of their first appearance in txids.
+// The same txid is retrieved only once, and the rest of the calls are canceled at the first error.
+func (c *Client) GetTxs(ctx context.Context, txids []string) ([]*Tx, error) {
+	unique := []string{}
+	seen := map[string]bool{}
+
+	for _, txid := range txids {
+		if !seen[txid] {
+			seen[txid] = true
+			unique = append(unique, txid)
+		}
+	}
+
+	txs := make([]*Tx, len(unique))
+
+	err := c.forEach(ctx, len(unique), func(ctx context.Context, i int) error {
+		tx, err := c.GetTx(ctx, unique[i])
+		if err != nil {
+			return fmt.Errorf("couldn't get tx of %s: %w", unique[i], err)
+		}
+
+		txs[i] = tx
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
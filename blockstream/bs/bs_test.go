@@ -0,0 +1,697 @@
+package bs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/3f2cm/mybtc/blockstream/bs"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	testAddr      = "mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv"
+	testScript    = "76a914b4e72e4582c8ef7f510447d90f0249ad8b29b6b788ac"
+	otherAddr     = "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"
+	otherScript   = "00143e73b512900677abbff836104829b733de821867"
+	chainPageSize = 25
+)
+
+// esplora is a stand-in of the Esplora API serving the history of testAddr.
+type esplora struct {
+	// mempool and chain are the transactions of testAddr, newest first.
+	mempool []bs.Tx
+	chain   []bs.Tx
+	// spent tells whether the outputs are spent by txid:vout.
+	spent map[string]bool
+	// tooMany makes the UTXO endpoint fail as for addresses with long history.
+	tooMany bool
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+// newEsplora makes the history of testAddr with the number of transactions in the mempool and in the chain.
+// Each transaction pays to testAddr and another address, and the outputs to testAddr are spent at every third.
+func newEsplora(nMempool, nChain int) *esplora {
+	e := &esplora{spent: map[string]bool{}, requests: map[string]int{}}
+
+	for i := 0; i < nMempool+nChain; i++ {
+		tx := bs.Tx{
+			TxID:    fmt.Sprintf("%064x", i+1),
+			Version: 2,
+			Vout: []bs.Vout{
+				{ScriptPubKey: otherScript, ScriptPubKeyAddress: otherAddr, Value: 1000},
+				{ScriptPubKey: testScript, ScriptPubKeyAddress: testAddr, Value: uint64(10000 + i)},
+			},
+			Status: bs.TxStatus{Confirmed: i >= nMempool},
+		}
+
+		if i%3 == 0 {
+			e.spent[fmt.Sprintf("%s:1", tx.TxID)] = true
+		}
+
+		if i < nMempool {
+			e.mempool = append(e.mempool, tx)
+		} else {
+			e.chain = append(e.chain, tx)
+		}
+	}
+
+	return e
+}
+
+// addSpentSiblings adds another output to testAddr to each transaction, which is spent.
+func (e *esplora) addSpentSiblings() {
+	for _, txs := range [][]bs.Tx{e.mempool, e.chain} {
+		for i := range txs {
+			txs[i].Vout = append(txs[i].Vout, bs.Vout{ScriptPubKey: testScript, ScriptPubKeyAddress: testAddr, Value: 500})
+			e.spent[fmt.Sprintf("%s:2", txs[i].TxID)] = true
+		}
+	}
+}
+
+// unspent returns the summaries of the unspent outputs to testAddr in the order of the history.
+func (e *esplora) unspent() []bs.VinSummary {
+	utxos := []bs.VinSummary{}
+
+	for _, tx := range append(append([]bs.Tx{}, e.mempool...), e.chain...) {
+		if e.spent[fmt.Sprintf("%s:1", tx.TxID)] {
+			continue
+		}
+
+		utxos = append(utxos, bs.VinSummary{TxID: tx.TxID, Vout: 1, ScriptPubKey: testScript, Value: tx.Vout[1].Value, Status: tx.Status})
+	}
+
+	return utxos
+}
+
+func (e *esplora) count(path string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.requests[path]
+}
+
+func (e *esplora) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	e.requests[r.URL.Path]++
+	e.mu.Unlock()
+
+	txs := map[string]bs.Tx{}
+	for _, tx := range append(append([]bs.Tx{}, e.mempool...), e.chain...) {
+		txs[tx.TxID] = tx
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 3 && parts[0] == "address" && parts[2] == "utxo":
+		if e.tooMany {
+			http.Error(w, "Too many history entries", http.StatusBadRequest)
+
+			return
+		}
+
+		utxos := []bs.UTXO{}
+		for _, u := range e.unspent() {
+			utxos = append(utxos, bs.UTXO{TxID: u.TxID, Idx: u.Vout, Value: u.Value, Status: txs[u.TxID].Status})
+		}
+
+		writeJSON(w, utxos)
+	case len(parts) == 4 && parts[0] == "address" && parts[3] == "mempool":
+		writeJSON(w, e.mempool)
+	case len(parts) >= 4 && parts[0] == "address" && parts[3] == "chain":
+		start := 0
+
+		if len(parts) == 5 {
+			start = -1
+
+			for i, tx := range e.chain {
+				if tx.TxID == parts[4] {
+					start = i + 1
+				}
+			}
+
+			if start < 0 {
+				http.Error(w, "Invalid hex string", http.StatusBadRequest)
+
+				return
+			}
+		}
+
+		end := start + chainPageSize
+		if end > len(e.chain) {
+			end = len(e.chain)
+		}
+
+		writeJSON(w, e.chain[start:end])
+	case len(parts) == 2 && parts[0] == "tx":
+		tx, ok := txs[parts[1]]
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+
+			return
+		}
+
+		writeJSON(w, tx)
+	case len(parts) == 3 && parts[0] == "tx" && parts[2] == "outspends":
+		tx, ok := txs[parts[1]]
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+
+			return
+		}
+
+		outspends := make([]bs.Outspend, len(tx.Vout))
+		for i := range tx.Vout {
+			outspends[i].Spent = i == 0 || e.spent[fmt.Sprintf("%s:%d", tx.TxID, i)]
+		}
+
+		writeJSON(w, outspends)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	//nolint:errcheck // the response can't be helped at error
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, h http.Handler) *bs.Client {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c, err := bs.NewClient(&chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatalf("couldn't create a client: %s", err)
+	}
+
+	c.BaseURL = srv.URL
+	c.Limiter = nil
+	c.Backoff = time.Millisecond
+
+	return c
+}
+
+func TestClient_GetUTXOWithScriptPubKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		nMempool int
+		nChain   int
+		tooMany  bool
+		siblings bool
+	}{
+		{
+			name:   "short history",
+			nChain: 5,
+		},
+		{
+			name:     "spent outputs to the address in the same transactions",
+			nMempool: 1,
+			nChain:   5,
+			siblings: true,
+		},
+		{
+			name:     "spent outputs to the address in the same transactions in pages",
+			nChain:   chainPageSize + 1,
+			tooMany:  true,
+			siblings: true,
+		},
+		{
+			name:     "long history in pages",
+			nMempool: 3,
+			nChain:   2*chainPageSize + 7,
+			tooMany:  true,
+		},
+		{
+			name:    "long history in full pages",
+			nChain:  2 * chainPageSize,
+			tooMany: true,
+		},
+		{
+			name:    "no history",
+			tooMany: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEsplora(tt.nMempool, tt.nChain)
+			e.tooMany = tt.tooMany
+
+			if tt.siblings {
+				e.addSpentSiblings()
+			}
+
+			got, err := newTestClient(t, e).GetUTXOWithScriptPubKey(context.Background(), testAddr)
+			if err != nil {
+				t.Fatalf("GetUTXOWithScriptPubKey failed: %s", err)
+			}
+
+			if want := e.unspent(); !reflect.DeepEqual(got, want) {
+				t.Errorf("GetUTXOWithScriptPubKey returned %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestClient_GetUTXOWithScriptPubKeyOrder(t *testing.T) {
+	e := newEsplora(0, 2)
+	e.addSpentSiblings()
+	e.spent = map[string]bool{}
+
+	// the outputs of the transactions are interleaved in the UTXO
+	order := []struct {
+		tx   bs.Tx
+		vout uint32
+	}{{e.chain[0], 2}, {e.chain[1], 1}, {e.chain[0], 1}, {e.chain[1], 2}}
+
+	utxos := []bs.UTXO{}
+	want := []bs.VinSummary{}
+
+	for _, o := range order {
+		v := o.tx.Vout[o.vout]
+		utxos = append(utxos, bs.UTXO{TxID: o.tx.TxID, Idx: o.vout, Value: v.Value, Status: o.tx.Status})
+		want = append(want, bs.VinSummary{TxID: o.tx.TxID, Vout: o.vout, ScriptPubKey: v.ScriptPubKey, Value: v.Value, Status: o.tx.Status})
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/utxo") {
+			writeJSON(w, utxos)
+
+			return
+		}
+
+		e.ServeHTTP(w, r)
+	})
+
+	got, err := newTestClient(t, h).GetUTXOWithScriptPubKey(context.Background(), testAddr)
+	if err != nil {
+		t.Fatalf("GetUTXOWithScriptPubKey failed: %s", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetUTXOWithScriptPubKey returned %v, want them in the order of the UTXO %v", got, want)
+	}
+}
+
+func TestClient_GetHistory(t *testing.T) {
+	e := newEsplora(2, 3*chainPageSize+1)
+
+	got, err := newTestClient(t, e).GetHistory(context.Background(), testAddr)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %s", err)
+	}
+
+	if want := append(append([]bs.Tx{}, e.mempool...), e.chain...); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetHistory returned %d transactions, want %d", len(got), len(want))
+	}
+
+	// the first page, the pages after the 25th, 50th and 75th transactions, and the empty one
+	pages := 0
+	for _, tx := range append([]bs.Tx{{}}, e.chain...) {
+		pages += e.count(strings.TrimSuffix(fmt.Sprintf("/address/%s/txs/chain/%s", testAddr, tx.TxID), "/"))
+	}
+
+	if pages != 5 {
+		t.Errorf("GetHistory requested %d pages, want 5", pages)
+	}
+}
+
+func TestClient_GetHistoryIgnoredLastSeen(t *testing.T) {
+	e := newEsplora(0, chainPageSize)
+
+	// the API always returns the first page
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/txs/chain/") {
+			r.URL.Path = fmt.Sprintf("/address/%s/txs/chain", testAddr)
+		}
+
+		e.ServeHTTP(w, r)
+	})
+
+	got, err := newTestClient(t, h).GetHistory(context.Background(), testAddr)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %s", err)
+	}
+
+	if len(got) != chainPageSize {
+		t.Errorf("GetHistory returned %d transactions, want %d", len(got), chainPageSize)
+	}
+}
+
+func TestClient_GetTxs(t *testing.T) {
+	e := newEsplora(0, 10)
+
+	var inFlight, maxInFlight int32
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for m := atomic.LoadInt32(&maxInFlight); n > m && !atomic.CompareAndSwapInt32(&maxInFlight, m, n); {
+			m = atomic.LoadInt32(&maxInFlight)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		e.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, h)
+	c.Concurrency = 3
+
+	// oldest first, and then all of them again
+	txids := []string{}
+	for i := len(e.chain) - 1; i >= 0; i-- {
+		txids = append(txids, e.chain[i].TxID)
+	}
+
+	txids = append(txids, txids...)
+
+	got, err := c.GetTxs(context.Background(), txids)
+	if err != nil {
+		t.Fatalf("GetTxs failed: %s", err)
+	}
+
+	if len(got) != len(e.chain) {
+		t.Fatalf("GetTxs returned %d transactions, want %d", len(got), len(e.chain))
+	}
+
+	for i, tx := range got {
+		if want := e.chain[len(e.chain)-1-i].TxID; tx.TxID != want {
+			t.Errorf("GetTxs returned %s at %d, want %s", tx.TxID, i, want)
+		}
+
+		if n := e.count("/tx/" + tx.TxID); n != 1 {
+			t.Errorf("GetTxs requested %s %d times, want once", tx.TxID, n)
+		}
+	}
+
+	if maxInFlight > 3 {
+		t.Errorf("GetTxs sent %d requests at once, want at most 3", maxInFlight)
+	}
+}
+
+func TestClient_GetTxsCancel(t *testing.T) {
+	e := newEsplora(0, 10)
+
+	// every transaction but the missing one takes long unless the request is canceled
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+
+		e.ServeHTTP(w, r)
+	})
+
+	c := newTestClient(t, h)
+	c.Concurrency = 2
+
+	txids := []string{e.chain[0].TxID, "missing"}
+	for _, tx := range e.chain[1:] {
+		txids = append(txids, tx.TxID)
+	}
+
+	start := time.Now()
+
+	if _, err := c.GetTxs(context.Background(), txids); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("GetTxs returned %v, want the error about the missing one", err)
+	}
+
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("GetTxs took %s, want the rest canceled", d)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := bs.NewLimiter(50, 2)
+	start := time.Now()
+
+	// 2 calls at once, and then 4 calls at every 20ms
+	for i := 0; i < 6; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait failed: %s", err)
+		}
+	}
+
+	if d := time.Since(start); d < 70*time.Millisecond {
+		t.Errorf("6 calls took %s, want about 80ms", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := bs.NewLimiter(0.1, 1).Wait(ctx); err == nil {
+		t.Error("Wait succeeded with the canceled context")
+	}
+}
+
+func TestClient_GetTxErrors(t *testing.T) {
+	tx := bs.Tx{TxID: fmt.Sprintf("%064x", 1)}
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		body         string
+		wantErr      interface{}
+		wantRequests int
+		wantWait     time.Duration
+	}{
+		{
+			name:         "not found",
+			statuses:     []int{http.StatusNotFound},
+			body:         "Transaction not found",
+			wantErr:      new(*bs.NotFoundError),
+			wantRequests: 1,
+		},
+		{
+			name:         "rate limited and then succeeded",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "rate limited with Retry-After",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "1",
+			wantRequests: 2,
+			wantWait:     time.Second,
+		},
+		{
+			name:         "rate limited until the end",
+			statuses:     []int{http.StatusTooManyRequests},
+			wantErr:      new(*bs.RateLimitedError),
+			wantRequests: 3,
+		},
+		{
+			name:         "server error until the end",
+			statuses:     []int{http.StatusServiceUnavailable},
+			wantErr:      new(*bs.ServerError),
+			wantRequests: 3,
+		},
+		{
+			name:         "too many history entries",
+			statuses:     []int{http.StatusBadRequest},
+			body:         "Too many history entries",
+			wantErr:      new(*bs.TooManyHistoryError),
+			wantRequests: 1,
+		},
+		{
+			name:         "other bad request",
+			statuses:     []int{http.StatusBadRequest},
+			body:         "Invalid hex string",
+			wantErr:      new(*bs.StatusError),
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&requests, 1))
+				if n > len(tt.statuses) {
+					n = len(tt.statuses)
+				}
+
+				if status := tt.statuses[n-1]; status != http.StatusOK {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+
+					http.Error(w, tt.body, status)
+
+					return
+				}
+
+				writeJSON(w, tx)
+			})
+
+			c := newTestClient(t, h)
+			c.Retries = 2
+			start := time.Now()
+
+			got, err := c.GetTx(context.Background(), tx.TxID)
+
+			if d := time.Since(start); d < tt.wantWait {
+				t.Errorf("GetTx took %s, want at least %s", d, tt.wantWait)
+			}
+
+			if n := int(atomic.LoadInt32(&requests)); n != tt.wantRequests {
+				t.Errorf("GetTx sent %d requests, want %d", n, tt.wantRequests)
+			}
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("GetTx failed: %s", err)
+				}
+
+				if got.TxID != tx.TxID {
+					t.Errorf("GetTx returned %s, want %s", got.TxID, tx.TxID)
+				}
+
+				return
+			}
+
+			if !errors.As(err, tt.wantErr) {
+				t.Fatalf("GetTx returned %v, want %T", err, tt.wantErr)
+			}
+
+			if !strings.Contains(err.Error(), tt.body) {
+				t.Errorf("GetTx returned %q, want the body %q", err, tt.body)
+			}
+		})
+	}
+}
+
+func TestClient_GetTxCache(t *testing.T) {
+	e := newEsplora(1, 1)
+	unconfirmed, confirmed := e.mempool[0].TxID, e.chain[0].TxID
+	dir := t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		c := newTestClient(t, e)
+		c.Cache = bs.NewCache(dir)
+
+		for _, txid := range []string{unconfirmed, confirmed} {
+			tx, err := c.GetTx(context.Background(), txid)
+			if err != nil {
+				t.Fatalf("GetTx failed: %s", err)
+			}
+
+			if tx.TxID != txid {
+				t.Errorf("GetTx returned %s, want %s", tx.TxID, txid)
+			}
+		}
+	}
+
+	if n := e.count("/tx/" + confirmed); n != 1 {
+		t.Errorf("the confirmed transaction was requested %d times, want once", n)
+	}
+
+	if n := e.count("/tx/" + unconfirmed); n != 2 {
+		t.Errorf("the unconfirmed transaction was requested %d times, want twice", n)
+	}
+
+	c := bs.NewCache(dir)
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %s", err)
+	}
+
+	if stats.Entries != 1 || stats.Size == 0 {
+		t.Errorf("Stats returned %+v, want 1 entry", stats)
+	}
+
+	if removed, err := c.Prune(time.Hour); err != nil || removed != 0 {
+		t.Errorf("Prune(1h) returned %d, %v, want nothing removed", removed, err)
+	}
+
+	if removed, err := c.Prune(0); err != nil || removed != 1 {
+		t.Errorf("Prune(0) returned %d, %v, want 1 removed", removed, err)
+	}
+
+	if _, ok := c.Get(confirmed); ok {
+		t.Error("Get found the pruned transaction")
+	}
+}
+
+func TestClient_GetTxUnwritableCache(t *testing.T) {
+	e := newEsplora(0, 1)
+	txid := e.chain[0].TxID
+
+	// a file is in the place of the cache directory
+	dir := filepath.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatalf("couldn't create a file: %s", err)
+	}
+
+	c := newTestClient(t, e)
+	c.Cache = bs.NewCache(dir)
+
+	for i := 0; i < 2; i++ {
+		tx, err := c.GetTx(context.Background(), txid)
+		if err != nil {
+			t.Fatalf("GetTx failed with the unwritable cache: %s", err)
+		}
+
+		if tx.TxID != txid {
+			t.Errorf("GetTx returned %s, want %s", tx.TxID, txid)
+		}
+	}
+
+	if n := e.count("/tx/" + txid); n != 2 {
+		t.Errorf("the transaction was requested %d times, want twice without the cache", n)
+	}
+}
+
+func TestClient_GetTxMismatch(t *testing.T) {
+	txid := fmt.Sprintf("%064x", 1)
+	other := bs.Tx{TxID: fmt.Sprintf("%064x", 2), Status: bs.TxStatus{Confirmed: true}}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, other)
+	})
+
+	dir := t.TempDir()
+	c := newTestClient(t, h)
+	c.Cache = bs.NewCache(dir)
+
+	if tx, err := c.GetTx(context.Background(), txid); err == nil {
+		t.Fatalf("GetTx returned %s for %s, want an error", tx.TxID, txid)
+	}
+
+	stats, err := bs.NewCache(dir).Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %s", err)
+	}
+
+	if stats.Entries != 0 {
+		t.Errorf("the mismatched transaction was cached: %+v", stats)
+	}
+}
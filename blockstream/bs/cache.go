@@ -0,0 +1,183 @@
+package bs
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errInvalidTxID = errors.New("invalid txid")
+
+// Cache keeps confirmed transactions on disk, keyed by their txid.
+// Confirmed transactions never change, so the entries never expire by themselves.
+// A nil Cache caches nothing.
+type Cache struct {
+	// Dir is the directory of the cache, which should be separated by the network.
+	Dir string
+}
+
+// CacheStats describes the entries in the cache.
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+}
+
+// NewCache returns a cache in the directory, which is created at the first entry.
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// path returns the path of the entry of the txid, which is split by the first byte to keep directories small.
+func (c *Cache) path(txid string) (string, error) {
+	if b, err := hex.DecodeString(txid); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("%w: %s", errInvalidTxID, txid)
+	}
+
+	return filepath.Join(c.Dir, "tx", txid[:2], txid+".json"), nil
+}
+
+// Get returns the cached transaction of the txid, and false if it is not cached or the entry is broken.
+func (c *Cache) Get(txid string) (*Tx, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	path, err := c.path(txid)
+	if err != nil {
+		return nil, false
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	tx := &Tx{}
+	if err := json.Unmarshal(b, tx); err != nil || tx.TxID != txid {
+		return nil, false
+	}
+
+	return tx, true
+}
+
+// Put caches the transaction if it is confirmed.
+func (c *Cache) Put(tx *Tx) error {
+	if c == nil || !tx.Status.Confirmed {
+		return nil
+	}
+
+	path, err := c.path(tx.TxID)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(tx)
+	if err != nil {
+		return fmt.Errorf("couldn't serialize the transaction: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("couldn't create the cache directory: %w", err)
+	}
+
+	// Writing to a temporary file and renaming it keeps the entry complete even if it is interrupted
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("couldn't create a cache entry: %w", err)
+	}
+
+	//nolint:errcheck // it's already renamed unless failed
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		//nolint:errcheck // the error of writing matters
+		f.Close()
+
+		return fmt.Errorf("couldn't write a cache entry: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("couldn't write a cache entry: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("couldn't write a cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// Stats counts the entries in the cache and their total size in bytes.
+func (c *Cache) Stats() (CacheStats, error) {
+	stats := CacheStats{}
+
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		stats.Entries++
+		stats.Size += info.Size()
+
+		return nil
+	})
+
+	return stats, err
+}
+
+// Prune removes the entries cached longer than olderThan ago, or all of them if olderThan is 0.
+// It returns the number of the removed entries.
+func (c *Cache) Prune(olderThan time.Duration) (int, error) {
+	removed := 0
+	deadline := time.Now().Add(-olderThan)
+
+	err := c.walk(func(path string, info fs.FileInfo) error {
+		if olderThan > 0 && info.ModTime().After(deadline) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("couldn't remove a cache entry: %w", err)
+		}
+
+		removed++
+
+		return nil
+	})
+
+	return removed, err
+}
+
+// walk calls f for every entry in the cache.
+func (c *Cache) walk(f func(path string, info fs.FileInfo) error) error {
+	root := filepath.Join(c.Dir, "tx")
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("couldn't get info of a cache entry: %w", err)
+		}
+
+		return f(path, info)
+	})
+
+	// No cache yet
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("couldn't walk the cache: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package bs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is the error of an unexpected status code of the API.
+// The errors of the specific status codes embed it.
+type StatusError struct {
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP request for %s failed: code: %d, body: %s", e.Path, e.Status, e.Body)
+}
+
+// NotFoundError is returned when the address or the transaction is not found.
+type NotFoundError struct {
+	StatusError
+}
+
+func (e *NotFoundError) Error() string {
+	return "not found: " + e.StatusError.Error()
+}
+
+// RateLimitedError is returned when the calls are too frequent even after retries.
+// RetryAfter is the time to wait given by the API, and it is 0 if not given.
+type RateLimitedError struct {
+	StatusError
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return "rate limited: " + e.StatusError.Error()
+}
+
+// TooManyHistoryError is returned when the address has too many history entries for the UTXO endpoint.
+type TooManyHistoryError struct {
+	StatusError
+}
+
+func (e *TooManyHistoryError) Error() string {
+	return "too many history entries: " + e.StatusError.Error()
+}
+
+// ServerError is returned when the API keeps failing by itself even after retries.
+type ServerError struct {
+	StatusError
+}
+
+func (e *ServerError) Error() string {
+	return "server error: " + e.StatusError.Error()
+}
+
+// newStatusError returns the error for the status code of the response.
+func newStatusError(path string, res *http.Response, body []byte) error {
+	s := StatusError{Path: path, Status: res.StatusCode, Body: strings.TrimSpace(string(body))}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return &NotFoundError{s}
+	case res.StatusCode == http.StatusTooManyRequests:
+		return &RateLimitedError{StatusError: s, RetryAfter: retryAfter(res.Header.Get("Retry-After"))}
+	case res.StatusCode == http.StatusBadRequest && strings.Contains(s.Body, "Too many history entries"):
+		return &TooManyHistoryError{s}
+	case res.StatusCode >= http.StatusInternalServerError:
+		return &ServerError{s}
+	default:
+		return &s
+	}
+}
+
+// retryAfter parses Retry-After header, which is either seconds or an HTTP date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+
+	return 0
+}
@@ -0,0 +1,169 @@
+package bs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Outspend expresses the spending status of an output.
+type Outspend struct {
+	Spent  bool     `json:"spent"`
+	TxID   string   `json:"txid"`
+	Vin    uint32   `json:"vin"`
+	Status TxStatus `json:"status"`
+}
+
+// getJSON retrieves the JSON at the path and parses it into v.
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	b, err := c.do(ctx, http.MethodGet, path, "")
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("couldn't parse the response for %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// GetChainTxs retrieves a page of the confirmed transactions of the address, newest first.
+// The page follows the transaction lastSeen, or it is the first page if lastSeen is empty.
+func (c *Client) GetChainTxs(ctx context.Context, a, lastSeen string) ([]Tx, error) {
+	path := fmt.Sprintf("/address/%s/txs/chain", a)
+	if lastSeen != "" {
+		path += "/" + lastSeen
+	}
+
+	txs := []Tx{}
+	if err := c.getJSON(ctx, path, &txs); err != nil {
+		return nil, fmt.Errorf("couldn't get transactions of %s: %w", a, err)
+	}
+
+	return txs, nil
+}
+
+// GetMempoolTxs retrieves the unconfirmed transactions of the address.
+func (c *Client) GetMempoolTxs(ctx context.Context, a string) ([]Tx, error) {
+	txs := []Tx{}
+	if err := c.getJSON(ctx, fmt.Sprintf("/address/%s/txs/mempool", a), &txs); err != nil {
+		return nil, fmt.Errorf("couldn't get unconfirmed transactions of %s: %w", a, err)
+	}
+
+	return txs, nil
+}
+
+// GetOutspends retrieves the spending status of every output of the transaction.
+func (c *Client) GetOutspends(ctx context.Context, txid string) ([]Outspend, error) {
+	outspends := []Outspend{}
+	if err := c.getJSON(ctx, fmt.Sprintf("/tx/%s/outspends", txid), &outspends); err != nil {
+		return nil, fmt.Errorf("couldn't get outspends of %s: %w", txid, err)
+	}
+
+	return outspends, nil
+}
+
+// GetHistory retrieves all the transactions of the address by walking the pages of the confirmed ones.
+// The unconfirmed transactions come first, and then the confirmed ones, newest first.
+func (c *Client) GetHistory(ctx context.Context, a string) ([]Tx, error) {
+	history, err := c.GetMempoolTxs(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, tx := range history {
+		seen[tx.TxID] = true
+	}
+
+	lastSeen := ""
+
+	for {
+		page, err := c.GetChainTxs(ctx, a, lastSeen)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+
+		for _, tx := range page {
+			if seen[tx.TxID] {
+				continue
+			}
+
+			seen[tx.TxID] = true
+			history = append(history, tx)
+			added++
+		}
+
+		// The last page is empty, and a page without new ones means the API ignores lastSeen
+		if added == 0 {
+			return history, nil
+		}
+
+		lastSeen = page[len(page)-1].TxID
+	}
+}
+
+// GetUTXOFromHistory reconstructs the UTXO of the address from its history and the spending status of the outputs.
+// It works for addresses with too many history entries for the UTXO endpoint.
+func (c *Client) GetUTXOFromHistory(ctx context.Context, a string) ([]VinSummary, error) {
+	history, err := c.GetHistory(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	received := []Tx{}
+
+	for _, tx := range history {
+		for _, vout := range tx.Vout {
+			if vout.ScriptPubKeyAddress == a {
+				received = append(received, tx)
+
+				break
+			}
+		}
+	}
+
+	outspends := make([][]Outspend, len(received))
+
+	err = c.forEach(ctx, len(received), func(ctx context.Context, i int) error {
+		o, err := c.GetOutspends(ctx, received[i].TxID)
+		if err != nil {
+			return err
+		}
+
+		if len(o) != len(received[i].Vout) {
+			return fmt.Errorf("%w: %d outspends for %d outputs of %s", errInconsistent, len(o), len(received[i].Vout), received[i].TxID)
+		}
+
+		outspends[i] = o
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := []VinSummary{}
+
+	for j, tx := range received {
+		for i, vout := range tx.Vout {
+			if vout.ScriptPubKeyAddress != a || outspends[j][i].Spent {
+				continue
+			}
+
+			utxos = append(utxos, VinSummary{
+				TxID:         tx.TxID,
+				Vout:         uint32(i),
+				ScriptPubKey: vout.ScriptPubKey,
+				Value:        vout.Value,
+				Status:       tx.Status,
+			})
+		}
+	}
+
+	return utxos, nil
+}
@@ -0,0 +1,138 @@
+package bs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket which limits the rate of the calls to the API.
+// It is safe for concurrent use, and a nil Limiter doesn't limit anything.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter which allows rate calls per second on average and burst calls at once.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a call is allowed or the context is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil || l == nil || l.rate <= 0 {
+		return err
+	}
+
+	for {
+		d := l.reserve()
+		if d == 0 {
+			return nil
+		}
+
+		t := time.NewTimer(d)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token if there is, and otherwise returns how long it takes to get one.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	l.last = now
+
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+
+	if l.tokens >= 1 {
+		l.tokens--
+
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// forEach calls f for every index below n with at most c.Concurrency calls at once.
+// The context given to f is canceled at the first error, which is returned.
+func (c *Client) forEach(ctx context.Context, n int, f func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := c.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				if err := f(ctx, i); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
@@ -3,7 +3,17 @@ Package cli package provides utilities to build CLI
 */
 package cli
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"golang.org/x/term"
+)
 
 // Env expresses the environment of the command execution
 // mainly for replacing IO for testing.
@@ -12,4 +22,194 @@ type Env struct {
 	Stdout io.Writer
 	Stderr io.Writer
 	Rand   io.Reader
+	// Net is the network to work on, which is set by the --network flag.
+	Net *chaincfg.Params
+	// Prompt asks for a secret without echoing it back.
+	// It is used for passphrases unless PassphraseEnv is set.
+	Prompt func(prompt string) (string, error)
+	// LookupEnv retrieves environment variables such as PassphraseEnv.
+	// os.LookupEnv is used if it is nil.
+	LookupEnv func(key string) (string, bool)
+	// Keystore is the path of the keystore file, which is set by the --keystore flag.
+	Keystore string
+	// EsploraURL is the base URL of the Esplora API, which is set by the --esplora-url flag.
+	// The default API for the network is used if it is empty.
+	EsploraURL string
+	// EsploraTimeout is the time limit of each call to the Esplora API, which is set by the --esplora-timeout flag.
+	EsploraTimeout time.Duration
+	// EsploraConcurrency is the number of calls at once to the Esplora API, which is set by the --esplora-concurrency flag.
+	EsploraConcurrency int
+	// EsploraRate is the limit of calls per second to the Esplora API, which is set by the --esplora-rate flag.
+	// The calls are not limited if it is 0.
+	EsploraRate float64
+	// EsploraRetries is the number of retries of the calls rate limited or failed by the Esplora API,
+	// which is set by the --esplora-retries flag.
+	EsploraRetries int
+	// CacheDir is the directory of the cache of confirmed transactions, which is set by the --cache-dir flag.
+	// Nothing is cached if it is empty.
+	CacheDir string
+	// NoCache disables the cache of confirmed transactions, which is set by the --no-cache flag.
+	NoCache bool
+
+	passphrase         *string
+	keystorePassphrase *string
+}
+
+// DefaultNetwork is the name of the network used when no network is specified.
+const DefaultNetwork = "testnet3"
+
+// PassphraseEnv is the name of the environment variable to give the passphrase without the prompt.
+const PassphraseEnv = "MYBTC_PASSPHRASE"
+
+// KeystorePassphraseEnv is the name of the environment variable to give the passphrase of the keystore.
+const KeystorePassphraseEnv = "MYBTC_KEYSTORE_PASSPHRASE"
+
+// KeystoreSessionEnv is the name of the environment variable to give the secret of the session of the keystore
+// printed by keystore unlock.
+const KeystoreSessionEnv = "MYBTC_KEYSTORE_SESSION"
+
+var (
+	errNoPrompt           = errors.New("the passphrase is required but can't be prompted")
+	errPassphraseMismatch = errors.New("the passphrases don't match")
+)
+
+// ParseNetwork returns the parameters of the network with the given name:
+// mainnet, testnet3, signet or regtest.
+func ParseNetwork(name string) (*chaincfg.Params, error) {
+	switch name {
+	case "mainnet":
+		return &chaincfg.MainNetParams, nil
+	case "testnet3", "testnet":
+		return &chaincfg.TestNet3Params, nil
+	case "signet":
+		return &chaincfg.SigNetParams, nil
+	case "regtest":
+		return &chaincfg.RegressionNetParams, nil
+	default:
+		return nil, fmt.Errorf("unknown network: %s (mainnet, testnet3, signet or regtest)", name)
+	}
+}
+
+// Passphrase returns the passphrase from PassphraseEnv or the prompt.
+// The passphrase is asked only once and reused after that.
+func (e *Env) Passphrase() (string, error) {
+	return e.secret(&e.passphrase, PassphraseEnv, "passphrase: ")
+}
+
+// KeystorePassphrase returns the passphrase of the keystore from KeystorePassphraseEnv or the prompt.
+// The passphrase is asked only once and reused after that.
+func (e *Env) KeystorePassphrase() (string, error) {
+	return e.secret(&e.keystorePassphrase, KeystorePassphraseEnv, "keystore passphrase: ")
+}
+
+// NewKeystorePassphrase returns a new passphrase of the keystore from KeystorePassphraseEnv,
+// or the prompt asking it twice to confirm it.
+func (e *Env) NewKeystorePassphrase() (string, error) {
+	if _, ok := e.lookupEnv(KeystorePassphraseEnv); ok || e.Prompt == nil || e.keystorePassphrase != nil {
+		return e.KeystorePassphrase()
+	}
+
+	p, err := e.Prompt("new keystore passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the passphrase: %w", err)
+	}
+
+	confirm, err := e.Prompt("confirm the passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the passphrase: %w", err)
+	}
+
+	if p != confirm {
+		return "", errPassphraseMismatch
+	}
+
+	e.keystorePassphrase = &p
+
+	return p, nil
+}
+
+// Getenv returns the value of the environment variable, which is empty if it isn't set.
+func (e *Env) Getenv(key string) string {
+	v, _ := e.lookupEnv(key)
+
+	return v
+}
+
+func (e *Env) lookupEnv(key string) (string, bool) {
+	if e.LookupEnv == nil {
+		return os.LookupEnv(key)
+	}
+
+	return e.LookupEnv(key)
+}
+
+func (e *Env) secret(cache **string, env, prompt string) (string, error) {
+	if *cache != nil {
+		return **cache, nil
+	}
+
+	p, ok := e.lookupEnv(env)
+	if !ok {
+		if e.Prompt == nil {
+			return "", fmt.Errorf("%w; set %s", errNoPrompt, env)
+		}
+
+		var err error
+
+		p, err = e.Prompt(prompt)
+		if err != nil {
+			return "", fmt.Errorf("couldn't read the passphrase: %w", err)
+		}
+	}
+
+	*cache = &p
+
+	return p, nil
+}
+
+// DefaultKeystore returns the path of the keystore in the user's config directory,
+// or an empty string if the directory is unknown.
+func DefaultKeystore() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "mybtc", "keystore.json")
+}
+
+// DefaultCacheDir returns the path of the cache directory in the user's cache directory such as $XDG_CACHE_HOME/mybtc,
+// or an empty string if the directory is unknown.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "mybtc")
+}
+
+// TerminalPrompt asks for a secret on the terminal, which works even when STDIN is redirected.
+func TerminalPrompt(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("couldn't open the terminal: %w", err)
+	}
+	//nolint:errcheck // nothing to do at error
+	defer tty.Close()
+
+	if _, err := tty.WriteString(prompt); err != nil {
+		return "", fmt.Errorf("couldn't write the prompt: %w", err)
+	}
+
+	b, err := term.ReadPassword(int(tty.Fd()))
+	if err != nil {
+		return "", fmt.Errorf("couldn't read from the terminal: %w", err)
+	}
+
+	if _, err := tty.WriteString("\n"); err != nil {
+		return "", fmt.Errorf("couldn't write to the terminal: %w", err)
+	}
+
+	return string(b), nil
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/3f2cm/mybtc/blockstream/bs"
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/spf13/cobra"
+)
+
+var errNoCacheDir = errors.New("the cache directory is unknown; give --cache-dir")
+
+// newCacheCmd generates command for cache subcommand.
+func newCacheCmd(env *cli.Env) *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "cache manages the cache of confirmed transactions",
+		Long: `cache command manages the cache of confirmed transactions retrieved from the Esplora API.
+
+Confirmed transactions never change, so they are kept in --cache-dir for each network
+($XDG_CACHE_HOME/mybtc by default), and --no-cache disables the cache.`,
+	}
+
+	// register subcommands
+	cacheCmd.AddCommand(newCacheStatsCmd(env))
+	cacheCmd.AddCommand(newCachePruneCmd(env))
+
+	return cacheCmd
+}
+
+func newCacheStatsCmd(env *cli.Env) *cobra.Command {
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "prints the number and the size of entries in the cache",
+		Long:  `prints the directory, the number of entries and their total size in bytes of the cache for the network`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := networkCache(env)
+			if err != nil {
+				return err
+			}
+
+			stats, err := c.Stats()
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("directory: %s\n", c.Dir)
+			cmd.Printf("entries: %d\n", stats.Entries)
+			cmd.Printf("size: %d bytes\n", stats.Size)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return statsCmd
+}
+
+func newCachePruneCmd(env *cli.Env) *cobra.Command {
+	var olderThan time.Duration
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "removes entries from the cache",
+		Long: `removes all the entries of the cache for the network, and prints the number of removed ones
+
+Only the entries cached longer than --older-than ago are removed if it is given, e.g. --older-than 720h.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := networkCache(env)
+			if err != nil {
+				return err
+			}
+
+			removed, err := c.Prune(olderThan)
+			if err != nil {
+				return err
+			}
+
+			cmd.Printf("removed %d entries\n", removed)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	pruneCmd.Flags().DurationVar(&olderThan, "older-than", 0, "remove only entries cached longer than this ago")
+
+	return pruneCmd
+}
+
+// networkCache returns the cache for the network in the cache directory.
+func networkCache(env *cli.Env) (*bs.Cache, error) {
+	if env.CacheDir == "" {
+		return nil, errNoCacheDir
+	}
+
+	return bs.NewCache(filepath.Join(env.CacheDir, env.Net.Name)), nil
+}
+
+// txCache returns the cache for the Esplora client, or nil if the cache is disabled or unknown.
+func txCache(env *cli.Env) *bs.Cache {
+	if env.NoCache || env.CacheDir == "" {
+		return nil
+	}
+
+	c, _ := networkCache(env)
+
+	return c
+}
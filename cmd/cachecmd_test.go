@@ -0,0 +1,81 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/3f2cm/mybtc/blockstream/bs"
+)
+
+// Test_newCacheCmd runs cache commands in order on one cache with two testnet3 transactions.
+func Test_newCacheCmd(t *testing.T) {
+	dir := t.TempDir()
+	c := bs.NewCache(filepath.Join(dir, "testnet3"))
+	size := 0
+
+	for i := 1; i <= 2; i++ {
+		tx := &bs.Tx{TxID: fmt.Sprintf("%064x", i), Status: bs.TxStatus{Confirmed: true}}
+		if err := c.Put(tx); err != nil {
+			t.Fatalf("couldn't cache a transaction: %s", err)
+		}
+
+		b, err := json.Marshal(tx)
+		if err != nil {
+			t.Fatalf("couldn't serialize a transaction: %s", err)
+		}
+
+		size += len(b)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{
+			name: "stats",
+			args: []string{"cache", "stats", "--cache-dir", dir},
+			want: fmt.Sprintf("directory: %s\nentries: 2\nsize: %d bytes\n", filepath.Join(dir, "testnet3"), size),
+		},
+		{
+			name: "stats for another network",
+			args: []string{"--network", "mainnet", "cache", "stats", "--cache-dir", dir},
+			want: fmt.Sprintf("directory: %s\nentries: 0\nsize: 0 bytes\n", filepath.Join(dir, "mainnet")),
+		},
+		{
+			name: "prune only old entries",
+			args: []string{"cache", "prune", "--older-than", "1h", "--cache-dir", dir},
+			want: "removed 0 entries\n",
+		},
+		{
+			name: "prune",
+			args: []string{"cache", "prune", "--cache-dir", dir},
+			want: "removed 2 entries\n",
+		},
+		{
+			name: "stats after pruned",
+			args: []string{"cache", "stats", "--cache-dir", dir},
+			want: fmt.Sprintf("directory: %s\nentries: 0\nsize: 0 bytes\n", filepath.Join(dir, "testnet3")),
+		},
+		{
+			name: "unknown cache directory",
+			args: []string{"cache", "stats"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, "", tt.args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc %v returned %s, want %s", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/hd"
+	"github.com/spf13/cobra"
+)
+
+// newHDCmd generates command for hd subcommand.
+func newHDCmd(env *cli.Env) *cobra.Command {
+	hdCmd := &cobra.Command{
+		Use:   "hd",
+		Short: "hd manipulates hierarchical deterministic keys",
+		Long: `hd command handles BIP32 hierarchical deterministic keys
+so that WIFs and addresses are derived from one master key along BIP44/49/84/86 paths.
+
+Master keys are read from STDIN.`,
+	}
+
+	// register subcommands
+	hdCmd.AddCommand(newHDGenerateCmd(env))
+	hdCmd.AddCommand(newHDExportCmd(env))
+	hdCmd.AddCommand(newHDDeriveCmd(env))
+
+	return hdCmd
+}
+
+func newHDGenerateCmd(env *cli.Env) *cobra.Command {
+	generateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "generates a new master key",
+		Long:  `generates a new master extended private key (tprv on the test networks) from a random seed`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			master, err := hd.NewMaster(env.Rand, env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't generate a master key: %w", err)
+			}
+
+			cmd.Println(master)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return generateCmd
+}
+
+func newHDExportCmd(env *cli.Env) *cobra.Command {
+	var (
+		purpose uint32
+		account uint32
+		private bool
+	)
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "exports the extended key of an account",
+		Long: `receives a master key from STDIN and prints the extended public key
+of the account m/purpose'/coin_type'/account', or the extended private key with --private.
+
+The version follows SLIP-132: tpub for BIP44 and BIP86, upub for BIP49 and vpub for BIP84 on the test networks.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			master, err := readMasterKey(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			key, err := hd.Export(master, hd.Purpose(purpose), account, private, env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't export the account key: %w", err)
+			}
+
+			cmd.Println(key)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	exportCmd.Flags().Uint32Var(&purpose, "purpose", uint32(hd.PurposeBIP84), "purpose: 44, 49, 84 or 86")
+	exportCmd.Flags().Uint32Var(&account, "account", 0, "account index")
+	exportCmd.Flags().BoolVar(&private, "private", false, "export the extended private key")
+
+	return exportCmd
+}
+
+func newHDDeriveCmd(env *cli.Env) *cobra.Command {
+	var (
+		purpose uint32
+		account uint32
+		change  bool
+		index   uint32
+		count   uint32
+		asJSON  bool
+	)
+
+	deriveCmd := &cobra.Command{
+		Use:   "derive",
+		Short: "derives WIFs and addresses",
+		Long: `receives a master key from STDIN and derives WIFs and addresses
+at m/purpose'/coin_type'/account'/change/index for count indices from --index.
+
+Each line has the path, the WIF and the address separated with tabs, or the keys are printed as JSON with --json.
+The address type is decided by the purpose: P2PKH for 44, P2SH-P2WPKH for 49, P2WPKH for 84 and P2TR for 86.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			master, err := readMasterKey(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			keys, err := hd.Derive(master, hd.Purpose(purpose), account, change, index, count, env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't derive keys: %w", err)
+			}
+
+			if asJSON {
+				j, err := json.MarshalIndent(keys, "", "    ")
+				if err != nil {
+					return fmt.Errorf("couldn't serialize the keys: %w", err)
+				}
+
+				cmd.Println(string(j))
+
+				return nil
+			}
+
+			for _, k := range keys {
+				cmd.Printf("%s\t%s\t%s\n", k.Path, k.WIF, k.Addr)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	deriveCmd.Flags().Uint32Var(&purpose, "purpose", uint32(hd.PurposeBIP84), "purpose: 44, 49, 84 or 86")
+	deriveCmd.Flags().Uint32Var(&account, "account", 0, "account index")
+	deriveCmd.Flags().BoolVar(&change, "change", false, "derive from the internal (change) chain")
+	deriveCmd.Flags().Uint32Var(&index, "index", 0, "first index to derive")
+	deriveCmd.Flags().Uint32Var(&count, "count", 1, "number of keys to derive")
+	deriveCmd.Flags().BoolVar(&asJSON, "json", false, "print the keys as JSON")
+
+	return deriveCmd
+}
+
+var errNoMasterKey = errors.New("there is no master key in the input")
+
+// readMasterKey reads a base58 encoded master key.
+func readMasterKey(r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the input: %w", err)
+	}
+
+	k := strings.TrimSpace(string(b))
+	if k == "" {
+		return "", errNoMasterKey
+	}
+
+	return k, nil
+}
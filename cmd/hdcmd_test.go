@@ -0,0 +1,159 @@
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/cmd"
+)
+
+// The master keys of the mnemonic "abandon abandon ... about" used in the test vectors of BIP49, BIP84 and BIP86.
+const (
+	testMainNetMaster = "xprv9s21ZrQH143K3GJpoapnV8SFfukcVBSfeCficPSGfubmSFDxo1kuHnLisriDvSnRRuL2Qrg5ggqHKNVpxR86QEC8w35uxmGoggxtQTPvfUu"
+	testTestNetMaster = "tprv8ZgxMBicQKsPe5YMU9gHen4Ez3ApihUfykaqUorj9t6FDqy3nP6eoXiAo2ssvpAjoLroQxHqr3R5nE3a5dU3DHTjTgJDd7zrbniJr6nrCzd"
+)
+
+func Test_newHDGenerateCmd(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	rootCmd := cmd.NewRootCmd(&cli.Env{
+		Stdout: stdout,
+		Stderr: &bytes.Buffer{},
+		Rand:   bytes.NewReader(make([]byte, 32)),
+	}, []string{"hd", "generate"})
+
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("mybtc hd generate failed: %s", err)
+	}
+
+	want := "tprv8ZgxMBicQKsPe2MzCEmfUKuUyaerdtY5tR54SKCw3jKsmrjXixa4NFZTqjDvntbEnZPBL861gQ1FNQCDGaCBEpH7iZNWUHqexCgDRha6qRu\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("mybtc hd generate returned %s, want %s", got, want)
+	}
+}
+
+func Test_newHDCmd(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		stdout string
+		err    bool
+	}{
+		{
+			name:   "BIP44",
+			args:   []string{"--network", "mainnet", "hd", "derive", "--purpose", "44"},
+			stdin:  testMainNetMaster,
+			stdout: "m/44'/0'/0'/0/0\tL4p2b9VAf8k5aUahF1JCJUzZkgNEAqLfq8DDdQiyAprQAKSbu8hf\t1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA\n",
+		},
+		{
+			name:   "BIP49 on testnet3",
+			args:   []string{"hd", "derive", "--purpose", "49"},
+			stdin:  testTestNetMaster,
+			stdout: "m/49'/1'/0'/0/0\tcULrpoZGXiuC19Uhvykx7NugygA3k86b3hmdCeyvHYQZSxojGyXJ\t2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2\n",
+		},
+		{
+			name:  "BIP84 with count",
+			args:  []string{"--network", "mainnet", "hd", "derive", "--purpose", "84", "--count", "2"},
+			stdin: testMainNetMaster,
+			stdout: "m/84'/0'/0'/0/0\tKyZpNDKnfs94vbrwhJneDi77V6jF64PWPF8x5cdJb8ifgg2DUc9d\tbc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu\n" +
+				"m/84'/0'/0'/0/1\tKxpf5b8p3qX56DKEe5NqWbNUP9MnqoRFzZwHRtsFqhzuvUJsYZCy\tbc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g\n",
+		},
+		{
+			name:   "BIP86",
+			args:   []string{"--network", "mainnet", "hd", "derive", "--purpose", "86"},
+			stdin:  testMainNetMaster,
+			stdout: "m/86'/0'/0'/0/0\tKyRv5iFPHG7iB5E4CqvMzH3WFJVhbfYK4VY7XAedd9Ys69mEsPLQ\tbc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr\n",
+		},
+		{
+			name:   "export BIP84",
+			args:   []string{"--network", "mainnet", "hd", "export", "--purpose", "84"},
+			stdin:  testMainNetMaster,
+			stdout: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs\n",
+		},
+		{
+			name:   "export BIP86",
+			args:   []string{"--network", "mainnet", "hd", "export", "--purpose", "86"},
+			stdin:  testMainNetMaster,
+			stdout: "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ\n",
+		},
+		{
+			name:   "export BIP84 on testnet3",
+			args:   []string{"hd", "export", "--purpose", "84"},
+			stdin:  testTestNetMaster,
+			stdout: "vpub5Y6cjg78GGuNLsaPhmYsiw4gYX3HoQiRBiSwDaBXKUafCt9bNwWQiitDk5VZ5BVxYnQdwoTyXSs2JHRPAgjAvtbBrf8ZhDYe2jWAqvZVnsc\n",
+		},
+		{
+			name:   "last non-hardened index",
+			args:   []string{"--network", "mainnet", "hd", "derive", "--purpose", "84", "--index", "2147483647"},
+			stdin:  testMainNetMaster,
+			stdout: "m/84'/0'/0'/0/2147483647\tL1dCrL3QktUimYrMpqCeugV2EXrrwkgFRWWjRPiambyHXXffDE2D\tbc1qkev33hvxz82vkshaz62kwwxnpdcae3hhuvjcnt\n",
+		},
+		{
+			name:  "hardened index",
+			args:  []string{"--network", "mainnet", "hd", "derive", "--index", "2147483648"},
+			stdin: testMainNetMaster,
+			err:   true,
+		},
+		{
+			name:  "indices beyond the non-hardened ones",
+			args:  []string{"--network", "mainnet", "hd", "derive", "--index", "2147483647", "--count", "2"},
+			stdin: testMainNetMaster,
+			err:   true,
+		},
+		{
+			name:  "indices overflowing",
+			args:  []string{"--network", "mainnet", "hd", "derive", "--index", "4294967295", "--count", "2"},
+			stdin: testMainNetMaster,
+			err:   true,
+		},
+		{
+			name:  "too many keys",
+			args:  []string{"--network", "mainnet", "hd", "derive", "--count", "4000000000"},
+			stdin: testMainNetMaster,
+			err:   true,
+		},
+		{
+			name:  "hardened account",
+			args:  []string{"--network", "mainnet", "hd", "export", "--account", "2147483648"},
+			stdin: testMainNetMaster,
+			err:   true,
+		},
+		{
+			name:  "master key for another network",
+			args:  []string{"--network", "mainnet", "hd", "derive"},
+			stdin: testTestNetMaster,
+			err:   true,
+		},
+		{
+			name:  "unknown purpose",
+			args:  []string{"hd", "derive", "--purpose", "45"},
+			stdin: testTestNetMaster,
+			err:   true,
+		},
+		{
+			name:  "not a master key",
+			args:  []string{"hd", "derive"},
+			stdin: "vpub5Y6cjg78GGuNLsaPhmYsiw4gYX3HoQiRBiSwDaBXKUafCt9bNwWQiitDk5VZ5BVxYnQdwoTyXSs2JHRPAgjAvtbBrf8ZhDYe2jWAqvZVnsc",
+			err:   true,
+		},
+		{
+			name: "no master key",
+			args: []string{"hd", "export"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, tt.stdin, tt.args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got != tt.stdout {
+				t.Errorf("mybtc %s returned %s, want %s", strings.Join(tt.args, " "), got, tt.stdout)
+			}
+		})
+	}
+}
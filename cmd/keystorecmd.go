@@ -0,0 +1,316 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/keystore"
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/3f2cm/mybtc/wif"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errNoKeystorePath = errors.New("the path of the keystore is unknown; give --keystore")
+	errOneWIF         = errors.New("give exactly one WIF from STDIN")
+)
+
+// keystoreCmd represents the keystore command.
+func newKeystoreCmd(env *cli.Env) *cobra.Command {
+	keystoreCmd := &cobra.Command{
+		Use:   "keystore",
+		Short: "keystore manages WIFs saved with labels",
+		Long: `keystore command manages WIFs encrypted with a passphrase in the keystore file.
+
+The keystore is created by "keystore init" with the passphrase first.
+WIFs are saved by "wif generate --save <label>", and used by their labels in "keys" of tx generate inputs.
+The passphrase is read from $` + cli.KeystorePassphraseEnv + ` or prompted,
+unless the keystore is unlocked with $` + cli.KeystoreSessionEnv + ` printed by "keystore unlock".`,
+	}
+
+	// register subcommands
+	keystoreCmd.AddCommand(newKeystoreInitCmd(env))
+	keystoreCmd.AddCommand(newKeystoreListCmd(env))
+	keystoreCmd.AddCommand(newKeystoreImportCmd(env))
+	keystoreCmd.AddCommand(newKeystoreExportCmd(env))
+	keystoreCmd.AddCommand(newKeystoreDeleteCmd(env))
+	keystoreCmd.AddCommand(newKeystoreUnlockCmd(env))
+	keystoreCmd.AddCommand(newKeystoreLockCmd(env))
+
+	return keystoreCmd
+}
+
+func newKeystoreInitCmd(env *cli.Env) *cobra.Command {
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "creates a new keystore",
+		Long: `creates a new keystore with the passphrase, which is prompted twice to confirm it
+
+WIFs can't be saved before the keystore is created, and the passphrase can't be changed after that.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := openKeystore(env)
+			if err != nil {
+				return err
+			}
+
+			passphrase, err := env.NewKeystorePassphrase()
+			if err != nil {
+				return err
+			}
+
+			if err := k.Create(passphrase); err != nil {
+				return fmt.Errorf("couldn't create the keystore: %w", err)
+			}
+
+			if err := k.Save(); err != nil {
+				return fmt.Errorf("couldn't save the keystore: %w", err)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return initCmd
+}
+
+func newKeystoreListCmd(env *cli.Env) *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "lists labels in the keystore",
+		Long: `lists the labels and the networks of WIFs in the keystore
+
+The passphrase is not required.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := openKeystore(env)
+			if err != nil {
+				return err
+			}
+
+			for _, e := range k.List() {
+				cmd.Printf("%s\t%s\n", e.Label, e.Network)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return listCmd
+}
+
+func newKeystoreImportCmd(env *cli.Env) *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import <label>",
+		Short: "saves a WIF in the keystore",
+		Long:  `receives a WIF from STDIN and saves it in the keystore with the label`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lines, err := readLines(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			if len(lines) != 1 {
+				return errOneWIF
+			}
+
+			if _, err := wif.Decode(lines[0], env.Net); err != nil {
+				return fmt.Errorf("couldn't import the WIF: %w", err)
+			}
+
+			return saveWIF(env, args[0], lines[0])
+		},
+		SilenceUsage: true,
+	}
+
+	return importCmd
+}
+
+func newKeystoreExportCmd(env *cli.Env) *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export <label>...",
+		Short: "prints WIFs in the keystore",
+		Long:  `prints the WIFs with the given labels in the keystore`,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := unlockKeystore(env)
+			if err != nil {
+				return err
+			}
+
+			for _, label := range args {
+				w, err := k.Get(label)
+				if err != nil {
+					return fmt.Errorf("couldn't export the key: %w", err)
+				}
+
+				cmd.Println(w)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return exportCmd
+}
+
+func newKeystoreDeleteCmd(env *cli.Env) *cobra.Command {
+	deleteCmd := &cobra.Command{
+		Use:   "delete <label>...",
+		Short: "deletes WIFs from the keystore",
+		Long: `deletes the WIFs with the given labels from the keystore
+
+The WIFs can't be recovered after that, so export them first if they may be needed.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := unlockKeystore(env)
+			if err != nil {
+				return err
+			}
+
+			for _, label := range args {
+				if err := k.Delete(label); err != nil {
+					return fmt.Errorf("couldn't delete the key: %w", err)
+				}
+			}
+
+			if err := k.Save(); err != nil {
+				return fmt.Errorf("couldn't save the keystore: %w", err)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return deleteCmd
+}
+
+func newKeystoreUnlockCmd(env *cli.Env) *cobra.Command {
+	var timeout time.Duration
+
+	unlockCmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "unlocks the keystore for a while",
+		Long: `checks the passphrase and keeps the keystore unlocked until the timeout or "keystore lock"
+
+The key derived from the passphrase is saved next to the keystore while it is unlocked,
+encrypted with a session secret which is only printed as a command to set $` + cli.KeystoreSessionEnv + `.
+The keystore is unlocked only where the variable is set, e.g. after eval "$(mybtc keystore unlock)".
+Anyone with both the secret and the file can decrypt the keys until the keystore is locked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := openKeystore(env)
+			if err != nil {
+				return err
+			}
+
+			passphrase, err := env.KeystorePassphrase()
+			if err != nil {
+				return err
+			}
+
+			if err := k.Unlock(passphrase); err != nil {
+				return fmt.Errorf("couldn't unlock the keystore: %w", err)
+			}
+
+			secret, err := k.SaveSession(timeout)
+			if err != nil {
+				return fmt.Errorf("couldn't save the session: %w", err)
+			}
+
+			cmd.Printf("export %s=%s\n", cli.KeystoreSessionEnv, secret)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	unlockCmd.Flags().DurationVar(&timeout, "timeout", 15*time.Minute, "duration to keep the keystore unlocked")
+
+	return unlockCmd
+}
+
+func newKeystoreLockCmd(env *cli.Env) *cobra.Command {
+	lockCmd := &cobra.Command{
+		Use:   "lock",
+		Short: "locks the keystore",
+		Long:  `locks the keystore unlocked by "keystore unlock" before the timeout`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := openKeystore(env)
+			if err != nil {
+				return err
+			}
+
+			if err := k.Lock(); err != nil {
+				return fmt.Errorf("couldn't lock the keystore: %w", err)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return lockCmd
+}
+
+func openKeystore(env *cli.Env) (*keystore.Keystore, error) {
+	if env.Keystore == "" {
+		return nil, errNoKeystorePath
+	}
+
+	k, err := keystore.Open(env.Keystore)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the keystore: %w", err)
+	}
+
+	return k, nil
+}
+
+// unlockKeystore opens the keystore and unlocks it with the session or the passphrase.
+func unlockKeystore(env *cli.Env) (*keystore.Keystore, error) {
+	k, err := openKeystore(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.LoadSession(env.Getenv(cli.KeystoreSessionEnv)); err == nil {
+		return k, nil
+	}
+
+	passphrase, err := env.KeystorePassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := k.Unlock(passphrase); err != nil {
+		return nil, fmt.Errorf("couldn't unlock the keystore: %w", err)
+	}
+
+	return k, nil
+}
+
+// keystoreKey returns a tx.KeyFunc which unlocks the keystore only when keys are looked up.
+func keystoreKey(env *cli.Env) tx.KeyFunc {
+	var k *keystore.Keystore
+
+	return func(label string) (string, error) {
+		if k == nil {
+			var err error
+
+			k, err = unlockKeystore(env)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		return k.Get(label)
+	}
+}
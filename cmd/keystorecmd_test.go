@@ -0,0 +1,291 @@
+package cmd_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/cmd"
+)
+
+// Test_newKeystoreCmd runs keystore commands in order on one keystore.
+func Test_newKeystoreCmd(t *testing.T) {
+	keystore := filepath.Join(t.TempDir(), "keystore.json")
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		passphrase string
+		// session is the session secret, where <secret> is replaced with the one printed by unlock.
+		session string
+		want    string
+		err     bool
+	}{
+		{
+			name:       "save a WIF before created",
+			args:       []string{"wif", "generate", "--save", "alice"},
+			passphrase: "correct horse",
+			err:        true,
+		},
+		{
+			name: "list before created",
+			args: []string{"keystore", "list"},
+		},
+		{
+			name:       "init",
+			args:       []string{"keystore", "init"},
+			passphrase: "correct horse",
+		},
+		{
+			name:       "init again",
+			args:       []string{"keystore", "init"},
+			passphrase: "wrong horse",
+			err:        true,
+		},
+		{
+			name:       "generate and save a WIF",
+			args:       []string{"wif", "generate", "--save", "alice"},
+			passphrase: "correct horse",
+		},
+		{
+			name:       "import a WIF",
+			args:       []string{"keystore", "import", "bob"},
+			stdin:      "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+			passphrase: "correct horse",
+		},
+		{
+			name:       "import a WIF for another network",
+			args:       []string{"keystore", "import", "carol"},
+			stdin:      "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR\n",
+			passphrase: "correct horse",
+			err:        true,
+		},
+		{
+			name:       "duplicated label",
+			args:       []string{"wif", "generate", "--save", "alice"},
+			passphrase: "correct horse",
+			err:        true,
+		},
+		{
+			name: "list without the passphrase",
+			args: []string{"keystore", "list"},
+			want: "alice\ttestnet3\nbob\ttestnet3\n",
+		},
+		{
+			name:       "export",
+			args:       []string{"keystore", "export", "alice", "bob"},
+			passphrase: "correct horse",
+			want:       "cNKwwBtVWr3nE8t3bL96iHUcja89Qrk8QmsEC1fm7fJpnrAtGR3z\ncVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+		},
+		{
+			name:       "export with a wrong passphrase",
+			args:       []string{"keystore", "export", "alice"},
+			passphrase: "wrong horse",
+			err:        true,
+		},
+		{
+			name:       "export an unknown label",
+			args:       []string{"keystore", "export", "carol"},
+			passphrase: "correct horse",
+			err:        true,
+		},
+		{
+			name: "export without the passphrase",
+			args: []string{"keystore", "export", "alice"},
+			err:  true,
+		},
+		{
+			name:       "unlock",
+			args:       []string{"keystore", "unlock", "--timeout", "1h"},
+			passphrase: "correct horse",
+			want:       "export " + cli.KeystoreSessionEnv + "=<secret>\n",
+		},
+		{
+			name:    "export while unlocked",
+			args:    []string{"keystore", "export", "bob"},
+			session: "<secret>",
+			want:    "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+		},
+		{
+			name: "export while unlocked without the session secret",
+			args: []string{"keystore", "export", "bob"},
+			err:  true,
+		},
+		{
+			name:    "export while unlocked with a wrong session secret",
+			args:    []string{"keystore", "export", "bob"},
+			session: strings.Repeat("00", 32),
+			err:     true,
+		},
+		{
+			name: "lock",
+			args: []string{"keystore", "lock"},
+		},
+		{
+			name:    "export after locked",
+			args:    []string{"keystore", "export", "bob"},
+			session: "<secret>",
+			err:     true,
+		},
+		{
+			name:       "delete",
+			args:       []string{"keystore", "delete", "alice"},
+			passphrase: "correct horse",
+		},
+		{
+			name: "list after deleted",
+			args: []string{"keystore", "list"},
+			want: "bob\ttestnet3\n",
+		},
+	}
+	secret := ""
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{cli.KeystoreSessionEnv: strings.ReplaceAll(tt.session, "<secret>", secret)}
+			if tt.passphrase != "" {
+				vars[cli.KeystorePassphraseEnv] = tt.passphrase
+			}
+
+			stdout := &bytes.Buffer{}
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdin:     strings.NewReader(tt.stdin),
+				Stdout:    stdout,
+				Stderr:    &bytes.Buffer{},
+				Rand:      rand.New(rand.NewSource(1)), //nolint:gosec // It's for test, and we need specified seeds
+				LookupEnv: lookupEnv(vars),
+				Keystore:  keystore,
+			}, tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			got := stdout.String()
+			if prefix := "export " + cli.KeystoreSessionEnv + "="; strings.HasPrefix(got, prefix) {
+				secret = strings.TrimSpace(strings.TrimPrefix(got, prefix))
+				got = prefix + "<secret>\n"
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc %s returned %s, want %s", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newKeystoreInitCmdPrompt checks that the passphrase of a new keystore is prompted twice to confirm it.
+func Test_newKeystoreInitCmdPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []string
+		err     bool
+	}{
+		{
+			name:    "confirmed",
+			answers: []string{"correct horse", "correct horse"},
+		},
+		{
+			name:    "mismatched",
+			answers: []string{"correct horse", "correct hose"},
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keystore := filepath.Join(t.TempDir(), "keystore.json")
+			prompts := []string{}
+
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdin:  strings.NewReader(""),
+				Stdout: &bytes.Buffer{},
+				Stderr: &bytes.Buffer{},
+				Prompt: func(prompt string) (string, error) {
+					prompts = append(prompts, prompt)
+
+					return tt.answers[len(prompts)-1], nil
+				},
+				LookupEnv: lookupEnv(nil),
+				Keystore:  keystore,
+			}, []string{"keystore", "init"})
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if len(prompts) != 2 {
+				t.Errorf("the passphrase was prompted %d times, want twice", len(prompts))
+			}
+
+			if _, err := os.Stat(keystore); (err == nil) == tt.err {
+				t.Errorf("the keystore exists: %v, want %v", err == nil, !tt.err)
+			}
+		})
+	}
+}
+
+// Test_newTxGenerateCmdKeys checks that keys in the keystore sign as the WIFs do.
+func Test_newTxGenerateCmdKeys(t *testing.T) {
+	keystore := filepath.Join(t.TempDir(), "keystore.json")
+	vars := map[string]string{cli.KeystorePassphraseEnv: "correct horse"}
+
+	if _, err := executeCmdWithEnv(t, vars, "", "--keystore", keystore, "keystore", "init"); err != nil {
+		t.Fatalf("couldn't create the keystore: %s", err)
+	}
+
+	if _, err := executeCmdWithEnv(t, vars, "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+		"--keystore", keystore, "keystore", "import", "bob"); err != nil {
+		t.Fatalf("couldn't import the WIF: %s", err)
+	}
+
+	input, err := os.ReadFile(path.Join("test_data", "sample_7_input.json"))
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	want, err := os.ReadFile(path.Join("test_data", "sample_7_tx.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		keys string
+		want string
+		err  bool
+	}{
+		{
+			name: "key in the keystore",
+			keys: `"keys": ["bob"]`,
+			want: string(want),
+		},
+		{
+			name: "unknown key",
+			keys: `"keys": ["alice"]`,
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withKeys := strings.Replace(string(input), `"wifs": [
+        "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk"
+    ]`, tt.keys, 1)
+
+			got, err := executeCmdWithEnv(t, vars, withKeys, "--keystore", keystore, "tx", "generate")
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("mybtc tx generate returned %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
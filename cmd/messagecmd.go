@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/message"
+	"github.com/3f2cm/mybtc/wif"
+	"github.com/spf13/cobra"
+)
+
+// newMessageCmd generates command for message subcommand.
+func newMessageCmd(env *cli.Env) *cobra.Command {
+	messageCmd := &cobra.Command{
+		Use:   "message",
+		Short: "message signs messages and verifies signatures",
+		Long: `message command signs messages to prove the ownership of addresses and verifies the signatures.
+
+The signatures are in the BIP137 format for P2PKH and P2SH-P2WPKH addresses,
+and in the BIP322 simple format for P2WPKH and P2TR ones.`,
+	}
+
+	// register subcommands
+	messageCmd.AddCommand(newMessageSignCmd(env))
+	messageCmd.AddCommand(newMessageVerifyCmd(env))
+
+	return messageCmd
+}
+
+func newMessageSignCmd(env *cli.Env) *cobra.Command {
+	var addrType string
+
+	signCmd := &cobra.Command{
+		Use:   "sign <message>",
+		Short: "signs a message with a WIF",
+		Long: `receives a WIF from STDIN and prints the signature in base64 of the message for its address
+
+The address type is P2PKH by default, and P2SH-P2WPKH, P2WPKH or P2TR (BIP86) with
+--type p2sh-p2wpkh, p2wpkh or p2tr.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lines, err := readLines(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			if len(lines) != 1 {
+				return errOneWIF
+			}
+
+			sig, err := message.Sign(lines[0], args[0], wif.AddrType(addrType), env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't sign the message: %w", err)
+			}
+
+			cmd.Println(sig)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	signCmd.Flags().StringVar(&addrType, "type", string(wif.AddrTypeP2PKH), "address type: p2pkh, p2sh-p2wpkh, p2wpkh or p2tr")
+
+	return signCmd
+}
+
+func newMessageVerifyCmd(env *cli.Env) *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify <address> <signature> <message>",
+		Short: "verifies a signature of a message",
+		Long: `verifies the signature in base64 of the message for the address, and prints "valid"
+
+It fails if the signature is invalid.`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := message.Verify(args[0], args[1], args[2], env.Net); err != nil {
+				return fmt.Errorf("couldn't verify the signature: %w", err)
+			}
+
+			cmd.Println("valid")
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return verifyCmd
+}
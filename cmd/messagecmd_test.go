@@ -0,0 +1,177 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_newMessageSignCmd(t *testing.T) {
+	const (
+		wif = "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk"
+		msg = "I own this address"
+	)
+
+	tests := []struct {
+		name     string
+		addrType string
+		addr     string
+		want     string
+	}{
+		{
+			name:     "BIP137 for P2PKH",
+			addrType: "p2pkh",
+			addr:     "mmDAoS3ikRwdzBsgthomvfHN8ju7iAzRwF",
+			want:     "IDXYFoPc6Y22CRJ1MTIczNG8IA20OAm5BY3Ic+KbblX3CBWlmEEriiB7pZbLuS2pMkqTq7k6yrLJ1IAnOTi7qY4=",
+		},
+		{
+			name:     "BIP137 for P2SH-P2WPKH",
+			addrType: "p2sh-p2wpkh",
+			addr:     "2N74kddRoV8rW74gyQ83ZLhUnbBQh2oKciG",
+			want:     "JDXYFoPc6Y22CRJ1MTIczNG8IA20OAm5BY3Ic+KbblX3CBWlmEEriiB7pZbLuS2pMkqTq7k6yrLJ1IAnOTi7qY4=",
+		},
+		{
+			name:     "BIP322 for P2WPKH",
+			addrType: "p2wpkh",
+			addr:     "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww",
+			want: "AkgwRQIhAOywzQNUTv1SAdcmHLAWpXWIIvY69VimOx7ctpZSMSMrAiBagyAGcV3dwJXd9nqlpzs7WKtf8fakNklc/jg5/T9pbgEhA746" +
+				"n6zpVpIH7sQVd1dpS6k8AxNUogG0Om4UCN9NwKHx",
+		},
+		{
+			name:     "BIP322 for P2TR",
+			addrType: "p2tr",
+			addr:     "tb1p9pypeen8kylunf0ds249ae3p9xlp4t9skv7tq83vmuxa9xjp0nuql7gv3u",
+			want:     "AUAJP/brIps5uDDHIKQvpaCK6M41pymvZJX7X5MslHC34kN6Rn3PEqL089IC5Y8XdxhGayd1uUDmlgYZiFZym94u",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, wif+"\n", "message", "sign", "--type", tt.addrType, msg)
+			if err != nil {
+				t.Fatalf("mybtc message sign failed: %s", err)
+			}
+
+			if got != tt.want+"\n" {
+				t.Errorf("mybtc message sign returned %q, want %q", got, tt.want+"\n")
+			}
+
+			if _, err := executeCmd(t, "", "message", "verify", tt.addr, strings.TrimSpace(got), msg); err != nil {
+				t.Errorf("mybtc message verify failed for the signature: %s", err)
+			}
+
+			if _, err := executeCmd(t, "", "message", "verify", tt.addr, strings.TrimSpace(got), msg+"!"); err == nil {
+				t.Errorf("mybtc message verify succeeded for another message")
+			}
+		})
+	}
+}
+
+func Test_newMessageVerifyCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  bool
+	}{
+		{
+			name: "BIP322 test vector of P2WPKH",
+			args: []string{
+				"--network", "mainnet", "message", "verify", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+				"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+				"Hello World",
+			},
+		},
+		{
+			name: "BIP322 test vector of P2WPKH for the empty message",
+			args: []string{
+				"--network", "mainnet", "message", "verify", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+				"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+				"",
+			},
+		},
+		{
+			name: "BIP322 test vector of P2TR",
+			args: []string{
+				"--network", "mainnet", "message", "verify", "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3",
+				"AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ==",
+				"Hello World",
+			},
+		},
+		{
+			name: "BIP322 signature for another message",
+			args: []string{
+				"--network", "mainnet", "message", "verify", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+				"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+				"Hello World",
+			},
+			err: true,
+		},
+		{
+			name: "BIP137 for an uncompressed P2PKH",
+			args: []string{
+				"message", "verify", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+				"HCJ9DJ4mITQFKUEEGpw5Ht9cMw476tvdUWP1ctMzx2DmD/M30p6b6Rk7lHtqwMLGKbnC10Vc+Qfiqv64ihDXPqs=",
+				"hi",
+			},
+		},
+		{
+			name: "BIP137 for a compressed P2PKH used for P2WPKH as Electrum does",
+			args: []string{
+				"message", "verify", "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww",
+				"IDXYFoPc6Y22CRJ1MTIczNG8IA20OAm5BY3Ic+KbblX3CBWlmEEriiB7pZbLuS2pMkqTq7k6yrLJ1IAnOTi7qY4=",
+				"I own this address",
+			},
+		},
+		{
+			name: "BIP137 for P2SH-P2WPKH used for P2PKH",
+			args: []string{
+				"message", "verify", "mmDAoS3ikRwdzBsgthomvfHN8ju7iAzRwF",
+				"JDXYFoPc6Y22CRJ1MTIczNG8IA20OAm5BY3Ic+KbblX3CBWlmEEriiB7pZbLuS2pMkqTq7k6yrLJ1IAnOTi7qY4=",
+				"I own this address",
+			},
+			err: true,
+		},
+		{
+			name: "BIP137 for another address",
+			args: []string{
+				"message", "verify", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+				"IDXYFoPc6Y22CRJ1MTIczNG8IA20OAm5BY3Ic+KbblX3CBWlmEEriiB7pZbLuS2pMkqTq7k6yrLJ1IAnOTi7qY4=",
+				"I own this address",
+			},
+			err: true,
+		},
+		{
+			name: "BIP322 simple signature for P2PKH",
+			args: []string{
+				"message", "verify", "mmDAoS3ikRwdzBsgthomvfHN8ju7iAzRwF",
+				"AUAJP/brIps5uDDHIKQvpaCK6M41pymvZJX7X5MslHC34kN6Rn3PEqL089IC5Y8XdxhGayd1uUDmlgYZiFZym94u",
+				"I own this address",
+			},
+			err: true,
+		},
+		{
+			name: "address for another network",
+			args: []string{
+				"message", "verify", "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l",
+				"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+				"Hello World",
+			},
+			err: true,
+		},
+		{
+			name: "signature not in base64",
+			args: []string{"message", "verify", "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww", "not base64!", "hi"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, "", tt.args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("mybtc %s returned error %v, want error %v", strings.Join(tt.args, " "), err, tt.err)
+			}
+
+			if !tt.err && got != "valid\n" {
+				t.Errorf("mybtc %s returned %q, want %q", strings.Join(tt.args, " "), got, "valid\n")
+			}
+		})
+	}
+}
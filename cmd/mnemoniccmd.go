@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/hd"
+	"github.com/3f2cm/mybtc/mnemonic"
+	"github.com/spf13/cobra"
+)
+
+// newMnemonicCmd generates command for mnemonic subcommand.
+func newMnemonicCmd(env *cli.Env) *cobra.Command {
+	mnemonicCmd := &cobra.Command{
+		Use:   "mnemonic",
+		Short: "mnemonic manipulates BIP39 mnemonics",
+		Long: `mnemonic command handles BIP39 mnemonic sentences in English
+so that master keys can be backed up by writing words down.
+
+Mnemonics are read from STDIN.`,
+	}
+
+	// register subcommands
+	mnemonicCmd.AddCommand(newMnemonicGenerateCmd(env))
+	mnemonicCmd.AddCommand(newMnemonicValidateCmd())
+	mnemonicCmd.AddCommand(newMnemonicSeedCmd(env))
+
+	return mnemonicCmd
+}
+
+func newMnemonicGenerateCmd(env *cli.Env) *cobra.Command {
+	var words int
+
+	generateCmd := &cobra.Command{
+		Use:   "generate",
+		Short: "generates a new mnemonic",
+		Long:  `generates a new mnemonic of 12, 15, 18, 21 or 24 words from random entropy`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := mnemonic.New(env.Rand, words)
+			if err != nil {
+				return fmt.Errorf("couldn't generate a mnemonic: %w", err)
+			}
+
+			cmd.Println(m)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	generateCmd.Flags().IntVar(&words, "words", 24, "number of words: 12, 15, 18, 21 or 24")
+
+	return generateCmd
+}
+
+func newMnemonicValidateCmd() *cobra.Command {
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "validates a mnemonic",
+		Long:  `receives a mnemonic from STDIN and checks its words and checksum`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := readMnemonic(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			if err := mnemonic.Validate(m); err != nil {
+				return fmt.Errorf("the mnemonic is invalid: %w", err)
+			}
+
+			cmd.Println("valid")
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return validateCmd
+}
+
+func newMnemonicSeedCmd(env *cli.Env) *cobra.Command {
+	var (
+		noPassphrase bool
+		asHex        bool
+	)
+
+	seedCmd := &cobra.Command{
+		Use:   "seed",
+		Short: "derives the master key from a mnemonic",
+		Long: `receives a mnemonic from STDIN and prints the BIP32 master key (tprv on the test networks)
+derived from the mnemonic and the BIP39 passphrase, which can be used with hd commands.
+With --hex, the seed is printed in hex instead.
+
+The passphrase is read from $` + cli.PassphraseEnv + ` or prompted.
+With --no-passphrase, the empty passphrase is used without asking.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := readMnemonic(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			// the passphrase isn't asked for invalid mnemonics
+			if err := mnemonic.Validate(m); err != nil {
+				return fmt.Errorf("couldn't derive the seed: %w", err)
+			}
+
+			passphrase := ""
+			if !noPassphrase {
+				passphrase, err = env.Passphrase()
+				if err != nil {
+					return err
+				}
+			}
+
+			seed, err := mnemonic.Seed(m, passphrase)
+			if err != nil {
+				return fmt.Errorf("couldn't derive the seed: %w", err)
+			}
+
+			if asHex {
+				cmd.Println(hex.EncodeToString(seed))
+
+				return nil
+			}
+
+			master, err := hd.NewMasterFromSeed(seed, env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't derive the master key: %w", err)
+			}
+
+			cmd.Println(master)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	seedCmd.Flags().BoolVar(&noPassphrase, "no-passphrase", false, "use the empty BIP39 passphrase without asking")
+	seedCmd.Flags().BoolVar(&asHex, "hex", false, "print the seed in hex instead of the master key")
+
+	return seedCmd
+}
+
+var errNoMnemonic = errors.New("there is no mnemonic in the input")
+
+// readMnemonic reads a mnemonic, which may span lines.
+func readMnemonic(r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the input: %w", err)
+	}
+
+	m := strings.Join(strings.Fields(string(b)), " ")
+	if m == "" {
+		return "", errNoMnemonic
+	}
+
+	return m, nil
+}
@@ -0,0 +1,189 @@
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/cmd"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func Test_newMnemonicGenerateCmd(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		entropy []byte
+		want    string
+		err     bool
+	}{
+		{
+			name:    "12 words",
+			args:    []string{"mnemonic", "generate", "--words", "12"},
+			entropy: make([]byte, 16),
+			want:    testMnemonic + "\n",
+		},
+		{
+			name:    "24 words",
+			args:    []string{"mnemonic", "generate"},
+			entropy: bytes.Repeat([]byte{0x7f}, 32),
+			want: "legal winner thank year wave sausage worth useful legal winner thank year " +
+				"wave sausage worth useful legal winner thank year wave sausage worth title\n",
+		},
+		{
+			name:    "invalid number of words",
+			args:    []string{"mnemonic", "generate", "--words", "13"},
+			entropy: make([]byte, 32),
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdout: stdout,
+				Stderr: &bytes.Buffer{},
+				Rand:   bytes.NewReader(tt.entropy),
+			}, tt.args)
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("mybtc mnemonic generate returned %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newMnemonicCmd checks the validation and the seed derivation with the test vectors of BIP39.
+func Test_newMnemonicCmd(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		passphrase string
+		stdin      string
+		stdout     string
+		err        bool
+	}{
+		{
+			name:   "valid",
+			args:   []string{"mnemonic", "validate"},
+			stdin:  testMnemonic + "\n",
+			stdout: "valid\n",
+		},
+		{
+			name:   "valid over lines",
+			args:   []string{"mnemonic", "validate"},
+			stdin:  strings.Replace(testMnemonic, " ", "\n", 5),
+			stdout: "valid\n",
+		},
+		{
+			name:  "invalid checksum",
+			args:  []string{"mnemonic", "validate"},
+			stdin: strings.Repeat("abandon ", 12),
+			err:   true,
+		},
+		{
+			name:  "unknown word",
+			args:  []string{"mnemonic", "validate"},
+			stdin: strings.Replace(testMnemonic, "about", "aboot", 1),
+			err:   true,
+		},
+		{
+			name:  "invalid number of words",
+			args:  []string{"mnemonic", "validate"},
+			stdin: strings.Repeat("abandon ", 11),
+			err:   true,
+		},
+		{
+			name:   "master key",
+			args:   []string{"mnemonic", "seed", "--no-passphrase"},
+			stdin:  testMnemonic,
+			stdout: testTestNetMaster + "\n",
+		},
+		{
+			name:       "master key with passphrase",
+			args:       []string{"--network", "mainnet", "mnemonic", "seed"},
+			passphrase: "TREZOR",
+			stdin:      testMnemonic,
+			stdout:     "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF\n",
+		},
+		{
+			name:       "seed with passphrase",
+			args:       []string{"mnemonic", "seed", "--hex"},
+			passphrase: "TREZOR",
+			stdin:      testMnemonic,
+			stdout: "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" +
+				"\n",
+		},
+		{
+			name:       "seed with fullwidth passphrase",
+			args:       []string{"mnemonic", "seed", "--hex"},
+			passphrase: "\uFF34\uFF32\uFF25\uFF3A\uFF2F\uFF32",
+			stdin:      testMnemonic,
+			stdout: "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04" +
+				"\n",
+		},
+		{
+			name:       "seed with composed passphrase",
+			args:       []string{"mnemonic", "seed", "--hex"},
+			passphrase: "caf\u00E9",
+			stdin:      testMnemonic,
+			stdout: "af8bbd2566df7b69d926f2b09dfdbd75db6c994a3399b2cc65f928d63e3fd4e61218ee0d15f8c810be4d45e66d47b43c15a5cc753976b1666912377ff7ae9818" +
+				"\n",
+		},
+		{
+			name:       "seed with decomposed passphrase",
+			args:       []string{"mnemonic", "seed", "--hex"},
+			passphrase: "cafe\u0301",
+			stdin:      testMnemonic,
+			stdout: "af8bbd2566df7b69d926f2b09dfdbd75db6c994a3399b2cc65f928d63e3fd4e61218ee0d15f8c810be4d45e66d47b43c15a5cc753976b1666912377ff7ae9818" +
+				"\n",
+		},
+		{
+			name:   "seed with empty passphrase from the environment",
+			args:   []string{"mnemonic", "seed"},
+			stdin:  testMnemonic,
+			stdout: testTestNetMaster + "\n",
+		},
+		{
+			name:  "seed without passphrase",
+			args:  []string{"mnemonic", "seed"},
+			stdin: testMnemonic,
+			err:   true,
+		},
+		{
+			name:  "seed of invalid mnemonic",
+			args:  []string{"mnemonic", "seed"},
+			stdin: strings.Repeat("abandon ", 12),
+			err:   true,
+		},
+		{
+			name: "no mnemonic",
+			args: []string{"mnemonic", "seed"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{}
+			if !tt.err {
+				vars[cli.PassphraseEnv] = tt.passphrase
+			}
+
+			got, err := executeCmdWithEnv(t, vars, tt.stdin, tt.args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got != tt.stdout {
+				t.Errorf("mybtc %s returned %s, want %s", strings.Join(tt.args, " "), got, tt.stdout)
+			}
+		})
+	}
+}
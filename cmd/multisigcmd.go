@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/multisig"
+	"github.com/spf13/cobra"
+)
+
+// newMultisigCmd generates command for multisig subcommand.
+func newMultisigCmd(env *cli.Env) *cobra.Command {
+	multisigCmd := &cobra.Command{
+		Use:   "multisig",
+		Short: "multisig handles m-of-n multisig scripts",
+		Long: `multisig command builds m-of-n multisig scripts shared by cosigners
+and the P2SH, P2WSH or P2SH-P2WSH addresses paying to them.`,
+	}
+
+	// register subcommands
+	multisigCmd.AddCommand(newMultisigAddressCmd(env))
+
+	return multisigCmd
+}
+
+func newMultisigAddressCmd(env *cli.Env) *cobra.Command {
+	var (
+		required int
+		addrType string
+		sorted   bool
+	)
+
+	addressCmd := &cobra.Command{
+		Use:   "address",
+		Short: "builds a multisig script and its address",
+		Long: `receives public keys in hex or WIFs from STDIN, and prints the address and the multisig script
+requiring --required signatures of them separated with a tab.
+
+The address type is P2WSH by default, and P2SH or P2SH-P2WSH with --type p2sh or p2sh-p2wsh.
+Give the script as "redeemscript" of tx generate inputs for P2SH, or as "witnessscript" for the others.
+The keys are sorted along BIP67 unless --sort=false, and then the order of the keys matters.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pubKeys := [][]byte{}
+
+			err := eachLine(cmd.InOrStdin(), func(i uint64, s string) error {
+				pubKey, err := multisig.ParseKey(s, env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't read the key at line %d: %w", i, err)
+				}
+
+				pubKeys = append(pubKeys, pubKey)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			script, err := multisig.Script(required, pubKeys, sorted)
+			if err != nil {
+				return fmt.Errorf("couldn't build the script: %w", err)
+			}
+
+			addr, err := multisig.Address(script, multisig.AddrType(addrType), env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't derive the address: %w", err)
+			}
+
+			cmd.Printf("%s\t%x\n", addr, script)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	addressCmd.Flags().IntVarP(&required, "required", "m", 0, "number of required signatures")
+	addressCmd.Flags().StringVar(&addrType, "type", string(multisig.AddrTypeP2WSH), "address type: p2sh, p2wsh or p2sh-p2wsh")
+	addressCmd.Flags().BoolVar(&sorted, "sort", true, "sort the keys along BIP67")
+	//nolint:errcheck // the flag surely exists
+	addressCmd.MarkFlagRequired("required")
+
+	return addressCmd
+}
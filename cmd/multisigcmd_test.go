@@ -0,0 +1,260 @@
+package cmd_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const sample9Script = "52210275344f2a20ed2299f11fbbacdbad8273156a50f7bcb29b3a32bcd9e1d68f511e2103be3a9face9569207eec4157757694ba93c031354a201b43a6e1408df4dc0a1f12103ea3bcbc13c756189a517e2f41a111229bf06f516a70986ae2bb1dd7dac90754653ae"
+
+func Test_newMultisigAddressCmd(t *testing.T) {
+	// the keys of the script in sample 9 out of the BIP67 order
+	sample9Keys := "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n" +
+		"cVptxTqUZCh9KrByXhvXn8dEGDpTLaXeo9HY435DS5fpEn6if3jg\n" +
+		"cUP3ovDzMfxdYsr2TmpAzFzbYYeFSP2fLEka7etjEgi4ci7u2TNi\n"
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+		err   bool
+	}{
+		{
+			name: "BIP67 test vector 1",
+			args: []string{"--network", "mainnet", "multisig", "address", "-m", "2", "--type", "p2sh"},
+			stdin: "02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8\n" +
+				"02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f\n",
+			want: "39bgKC7RFbpoCRbtD5KEdkYKtNyhpsNa3Z\t" +
+				"522102fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f" +
+				"2102ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f852ae\n",
+		},
+		{
+			name: "BIP67 test vector 1 without sorting",
+			args: []string{"--network", "mainnet", "multisig", "address", "-m", "2", "--type", "p2sh", "--sort=false"},
+			stdin: "02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8\n" +
+				"02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f\n",
+			want: "3KMjeDSoEmNpingAmLC4PsCrvK7cVJdbSp\t" +
+				"522102ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8" +
+				"2102fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f52ae\n",
+		},
+		{
+			name:  "P2WSH of WIFs",
+			args:  []string{"multisig", "address", "-m", "2"},
+			stdin: sample9Keys,
+			want:  "tb1ql4sml99cuqpn3f26ln2vhcajtnlndwtclkx409m0wa4lemcyt0zsztcu0a\t" + sample9Script + "\n",
+		},
+		{
+			name:  "P2SH-P2WSH of WIFs",
+			args:  []string{"multisig", "address", "-m", "2", "--type", "p2sh-p2wsh"},
+			stdin: sample9Keys,
+			want:  "2N8N6DPHDtoLSf6MdKYUmvznkcd8yYdAyzX\t" + sample9Script + "\n",
+		},
+		{
+			name:  "P2SH of WIFs",
+			args:  []string{"multisig", "address", "-m", "2", "--type", "p2sh"},
+			stdin: sample9Keys,
+			want:  "2NBtE8vR2uyiBtBefhpQj491UrvjGD9tzR5\t" + sample9Script + "\n",
+		},
+		{
+			name:  "more required signatures than keys",
+			args:  []string{"multisig", "address", "-m", "4"},
+			stdin: sample9Keys,
+			err:   true,
+		},
+		{
+			name:  "no required signatures",
+			args:  []string{"multisig", "address"},
+			stdin: sample9Keys,
+			err:   true,
+		},
+		{
+			name: "uncompressed key for P2WSH",
+			args: []string{"multisig", "address", "-m", "1"},
+			stdin: "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+				"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8\n",
+			err: true,
+		},
+		{
+			name:  "duplicated keys",
+			args:  []string{"multisig", "address", "-m", "1"},
+			stdin: "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\ncVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+			err:   true,
+		},
+		{
+			name:  "unknown address type",
+			args:  []string{"multisig", "address", "-m", "2", "--type", "p2tr"},
+			stdin: sample9Keys,
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, tt.stdin, tt.args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("mybtc %s returned error %v, want error %v", strings.Join(tt.args, " "), err, tt.err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc %s returned %q, want %q", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newTxGenerateCmdMultisigPartial signs sample 9 by each cosigner in turn,
+// passing the signatures of the first one to the second one.
+func Test_newTxGenerateCmdMultisigPartial(t *testing.T) {
+	b, err := os.ReadFile(path.Join("test_data", "sample_9_input.json"))
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	want, err := os.ReadFile(path.Join("test_data", "sample_9_tx.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	var input tx.Input
+	if err := json.Unmarshal(b, &input); err != nil {
+		t.Fatalf("couldn't parse the input file: %s", err)
+	}
+
+	wifs := input.WIFs
+
+	input.WIFs = wifs[:1]
+	partial := generateTx(t, input)
+
+	if partial == string(want) {
+		t.Fatalf("mybtc tx generate returned a fully signed tx with one WIF")
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err := msgTx.Deserialize(hex.NewDecoder(strings.NewReader(strings.TrimSpace(partial)))); err != nil {
+		t.Fatalf("couldn't decode the partially signed tx: %s", err)
+	}
+
+	for i, txIn := range msgTx.TxIn {
+		var sig []byte
+
+		if len(txIn.Witness) > 0 {
+			// <empty> <sig> <witness script>
+			sig = txIn.Witness[1]
+		} else {
+			// OP_0 <sig> <redeem script>
+			pushes, err := txscript.PushedData(txIn.SignatureScript)
+			if err != nil {
+				t.Fatalf("couldn't parse the signature script of the input %d: %s", i, err)
+			}
+
+			sig = pushes[1]
+		}
+
+		input.Ins[i].Sigs = []string{hex.EncodeToString(sig)}
+	}
+
+	input.WIFs = wifs[1:]
+	if got := generateTx(t, input); got != string(want) {
+		t.Errorf("mybtc tx generate with the cosigner's signatures returned %s, want %s", got, want)
+	}
+
+	// the signatures don't match the keys for another tx
+	input.Outs[0].Value--
+	if _, err := executeCmd(t, marshalInput(t, input), "tx", "generate"); err == nil {
+		t.Errorf("mybtc tx generate accepted signatures for another tx")
+	}
+}
+
+// Test_newPSBTCmdMultisig signs the P2WSH and P2SH-P2WSH multisig inputs of sample 9 with PSBTs
+// separately, and checks that the combined one results in the same transaction as tx generate.
+func Test_newPSBTCmdMultisig(t *testing.T) {
+	b, err := os.ReadFile(path.Join("test_data", "sample_9_input.json"))
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	var input tx.Input
+	if err := json.Unmarshal(b, &input); err != nil {
+		t.Fatalf("couldn't parse the input file: %s", err)
+	}
+
+	// the P2SH input requires the previous tx
+	input.Ins = input.Ins[:2]
+	input.Outs[0].Value -= 100000
+
+	want := generateTx(t, input)
+
+	unsigned, err := executeCmd(t, marshalInput(t, input), "psbt", "create")
+	if err != nil {
+		t.Fatalf("mybtc psbt create failed: %s", err)
+	}
+
+	signed := []string{}
+
+	for i, w := range input.WIFs {
+		wifsFile := path.Join(t.TempDir(), "wifs")
+		if err := os.WriteFile(wifsFile, []byte(w+"\n"), 0o600); err != nil {
+			t.Fatalf("couldn't write the WIF file: %s", err)
+		}
+
+		p, err := executeCmd(t, unsigned, "psbt", "sign", "--wifs", wifsFile)
+		if err != nil {
+			t.Fatalf("mybtc psbt sign with the WIF %d failed: %s", i, err)
+		}
+
+		if _, err := executeCmd(t, p, "psbt", "finalize"); err == nil {
+			t.Errorf("mybtc psbt finalize succeeded with the signatures of the WIF %d only", i)
+		}
+
+		signed = append(signed, p)
+	}
+
+	combined, err := executeCmd(t, strings.Join(signed, ""), "psbt", "combine")
+	if err != nil {
+		t.Fatalf("mybtc psbt combine failed: %s", err)
+	}
+
+	finalized, err := executeCmd(t, combined, "psbt", "finalize")
+	if err != nil {
+		t.Fatalf("mybtc psbt finalize failed: %s", err)
+	}
+
+	got, err := executeCmd(t, finalized, "psbt", "extract")
+	if err != nil {
+		t.Fatalf("mybtc psbt extract failed: %s", err)
+	}
+
+	if got != want {
+		t.Errorf("mybtc psbt extract returned %s, want %s", got, want)
+	}
+}
+
+func marshalInput(t *testing.T, input tx.Input) string {
+	t.Helper()
+
+	b, err := json.Marshal(input)
+	if err != nil {
+		t.Fatalf("couldn't marshal the input: %s", err)
+	}
+
+	return string(b)
+}
+
+func generateTx(t *testing.T, input tx.Input) string {
+	t.Helper()
+
+	got, err := executeCmd(t, marshalInput(t, input), "tx", "generate")
+	if err != nil {
+		t.Fatalf("mybtc tx generate failed: %s", err)
+	}
+
+	return got
+}
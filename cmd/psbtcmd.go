@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/spf13/cobra"
+)
+
+// newPSBTCmd generates command for psbt subcommand.
+func newPSBTCmd(env *cli.Env) *cobra.Command {
+	psbtCmd := &cobra.Command{
+		Use:   "psbt",
+		Short: "psbt manipulates partially signed transactions",
+		Long: `psbt command handles PSBTs (Partially Signed Bitcoin Transactions, BIP174)
+so that a transaction can be signed by several people without sharing WIFs.
+
+PSBTs are read from STDIN and written to STDOUT in base64.`,
+	}
+
+	// register subcommands
+	psbtCmd.AddCommand(newPSBTCreateCmd(env))
+	psbtCmd.AddCommand(newPSBTUpdateCmd())
+	psbtCmd.AddCommand(newPSBTSignCmd(env))
+	psbtCmd.AddCommand(newPSBTCombineCmd())
+	psbtCmd.AddCommand(newPSBTFinalizeCmd())
+	psbtCmd.AddCommand(newPSBTExtractCmd())
+
+	return psbtCmd
+}
+
+func newPSBTCreateCmd(env *cli.Env) *cobra.Command {
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "creates a PSBT from the input of tx generate",
+		Long: `receives the same input as tx generate from STDIN and creates an unsigned PSBT
+with the UTXO info of the ins. WIFs in the input are ignored.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("couldn't read the input: %w", err)
+			}
+
+			p, err := tx.CreatePSBT(input, env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't create a PSBT from input: %w", err)
+			}
+
+			cmd.Println(p)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return createCmd
+}
+
+func newPSBTUpdateCmd() *cobra.Command {
+	var inputFile string
+
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "adds UTXO info to a PSBT",
+		Long: `receives a PSBT from STDIN and adds the UTXO info of the ins
+in the file given with --input, which has the same format as the input of tx generate`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := readPSBT(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			input, err := os.ReadFile(inputFile)
+			if err != nil {
+				return fmt.Errorf("couldn't read the input file: %w", err)
+			}
+
+			p, err = tx.UpdatePSBT(p, input)
+			if err != nil {
+				return fmt.Errorf("couldn't update the PSBT: %w", err)
+			}
+
+			cmd.Println(p)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	updateCmd.Flags().StringVar(&inputFile, "input", "", "file of the input with ins")
+	//nolint:errcheck // the flag surely exists
+	updateCmd.MarkFlagRequired("input")
+
+	return updateCmd
+}
+
+func newPSBTSignCmd(env *cli.Env) *cobra.Command {
+	var wifsFile string
+
+	signCmd := &cobra.Command{
+		Use:   "sign",
+		Short: "signs a PSBT with WIFs",
+		Long: `receives a PSBT from STDIN and signs its inputs with WIFs
+in the file given with --wifs, one WIF per line.
+Inputs which can't be signed with the WIFs are left for others.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := readPSBT(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(wifsFile)
+			if err != nil {
+				return fmt.Errorf("couldn't open the WIF file: %w", err)
+			}
+			//nolint:errcheck // nothing to do at error
+			defer f.Close()
+
+			wifs, err := readLines(f)
+			if err != nil {
+				return fmt.Errorf("couldn't read the WIF file: %w", err)
+			}
+
+			p, err = tx.SignPSBT(p, wifs, env.Net, env.Passphrase)
+			if err != nil {
+				return fmt.Errorf("couldn't sign the PSBT: %w", err)
+			}
+
+			cmd.Println(p)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	signCmd.Flags().StringVar(&wifsFile, "wifs", "", "file of WIFs to sign with, one WIF per line")
+	//nolint:errcheck // the flag surely exists
+	signCmd.MarkFlagRequired("wifs")
+
+	return signCmd
+}
+
+func newPSBTCombineCmd() *cobra.Command {
+	combineCmd := &cobra.Command{
+		Use:   "combine",
+		Short: "combines PSBTs",
+		Long:  `receives PSBTs for the same transaction from STDIN, one PSBT per line, and combines them into one`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ps, err := readLines(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("couldn't read the input: %w", err)
+			}
+
+			p, err := tx.CombinePSBT(ps)
+			if err != nil {
+				return fmt.Errorf("couldn't combine the PSBTs: %w", err)
+			}
+
+			cmd.Println(p)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return combineCmd
+}
+
+func newPSBTFinalizeCmd() *cobra.Command {
+	finalizeCmd := &cobra.Command{
+		Use:   "finalize",
+		Short: "finalizes a PSBT",
+		Long:  `receives a fully signed PSBT from STDIN and builds the final scripts and witnesses of its inputs`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := readPSBT(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			p, err = tx.FinalizePSBT(p)
+			if err != nil {
+				return fmt.Errorf("couldn't finalize the PSBT: %w", err)
+			}
+
+			cmd.Println(p)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return finalizeCmd
+}
+
+func newPSBTExtractCmd() *cobra.Command {
+	extractCmd := &cobra.Command{
+		Use:   "extract",
+		Short: "extracts the signed transaction from a PSBT",
+		Long:  `receives a finalized PSBT from STDIN and prints the signed transaction in hex`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := readPSBT(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			t, err := tx.ExtractPSBT(p)
+			if err != nil {
+				return fmt.Errorf("couldn't extract the transaction: %w", err)
+			}
+
+			cmd.Println(hex.EncodeToString(t))
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	return extractCmd
+}
+
+var errNoPSBT = errors.New("there is no PSBT in the input")
+
+// readPSBT reads a base64 encoded PSBT.
+func readPSBT(r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the input: %w", err)
+	}
+
+	p := strings.TrimSpace(string(b))
+	if p == "" {
+		return "", errNoPSBT
+	}
+
+	return p, nil
+}
@@ -0,0 +1,202 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/cmd"
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+)
+
+func executeCmd(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	return executeCmdWithEnv(t, nil, stdin, args...)
+}
+
+// executeCmdWithEnv executes the command with the environment variables instead of the real ones.
+func executeCmdWithEnv(t *testing.T, vars map[string]string, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	rootCmd := cmd.NewRootCmd(&cli.Env{
+		Stdin:     strings.NewReader(stdin),
+		Stdout:    stdout,
+		Stderr:    stderr,
+		LookupEnv: lookupEnv(vars),
+	}, args)
+
+	err := rootCmd.Execute()
+
+	return stdout.String(), err
+}
+
+// lookupEnv returns the function to look up the environment variables in vars.
+func lookupEnv(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+
+		return v, ok
+	}
+}
+
+// Test_newPSBTCmd signs PSBTs separately with each WIF in the sample inputs,
+// and checks that the combined one results in the same transaction as tx generate.
+func Test_newPSBTCmd(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputFile  string
+		wantTxFile string
+	}{
+		{
+			name:       "sample 4 (P2TR and P2WPKH)",
+			inputFile:  "sample_4_input.json",
+			wantTxFile: "sample_4_tx.txt",
+		},
+		{
+			name:       "sample 5 (P2SH-P2WPKH and P2WPKH)",
+			inputFile:  "sample_5_input.json",
+			wantTxFile: "sample_5_tx.txt",
+		},
+		{
+			name:       "sample 6 (P2PKH with prevtx and P2SH-P2WPKH)",
+			inputFile:  "sample_6_input.json",
+			wantTxFile: "sample_6_tx.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := os.ReadFile(path.Join("test_data", tt.inputFile))
+			if err != nil {
+				t.Fatalf("couldn't read the input file %s: %s", tt.inputFile, err)
+			}
+
+			want, err := os.ReadFile(path.Join("test_data", tt.wantTxFile))
+			if err != nil {
+				t.Fatalf("couldn't read the tx file %s: %s", tt.wantTxFile, err)
+			}
+
+			var input tx.Input
+			if err := json.Unmarshal(b, &input); err != nil {
+				t.Fatalf("couldn't parse the input file %s: %s", tt.inputFile, err)
+			}
+
+			unsigned, err := executeCmd(t, string(b), "psbt", "create")
+			if err != nil {
+				t.Fatalf("mybtc psbt create failed: %s", err)
+			}
+
+			if _, err := executeCmd(t, unsigned, "psbt", "finalize"); err == nil {
+				t.Errorf("mybtc psbt finalize succeeded for an unsigned PSBT")
+			}
+
+			// each signer has only one WIF
+			signed := []string{}
+			for i, w := range input.WIFs {
+				wifsFile := path.Join(t.TempDir(), "wifs")
+				if err := os.WriteFile(wifsFile, []byte(w+"\n"), 0o600); err != nil {
+					t.Fatalf("couldn't write the WIF file: %s", err)
+				}
+
+				p, err := executeCmd(t, unsigned, "psbt", "sign", "--wifs", wifsFile)
+				if err != nil {
+					t.Fatalf("mybtc psbt sign with the WIF %d failed: %s", i, err)
+				}
+
+				signed = append(signed, p)
+			}
+
+			combined, err := executeCmd(t, strings.Join(signed, ""), "psbt", "combine")
+			if err != nil {
+				t.Fatalf("mybtc psbt combine failed: %s", err)
+			}
+
+			finalized, err := executeCmd(t, combined, "psbt", "finalize")
+			if err != nil {
+				t.Fatalf("mybtc psbt finalize failed: %s", err)
+			}
+
+			got, err := executeCmd(t, finalized, "psbt", "extract")
+			if err != nil {
+				t.Fatalf("mybtc psbt extract failed: %s", err)
+			}
+
+			if got != string(want) {
+				t.Errorf("mybtc psbt extract returned %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func Test_newPSBTUpdateCmd(t *testing.T) {
+	inputFile := path.Join("test_data", "sample_6_input.json")
+
+	b, err := os.ReadFile(inputFile)
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	created, err := executeCmd(t, string(b), "psbt", "create")
+	if err != nil {
+		t.Fatalf("mybtc psbt create failed: %s", err)
+	}
+
+	// strip the UTXO info as if the PSBT were created elsewhere
+	p, err := psbt.NewFromRawBytes(strings.NewReader(strings.TrimSpace(created)), true)
+	if err != nil {
+		t.Fatalf("couldn't decode the created PSBT: %s", err)
+	}
+
+	bare, err := psbt.NewFromUnsignedTx(p.UnsignedTx)
+	if err != nil {
+		t.Fatalf("couldn't create a bare PSBT: %s", err)
+	}
+
+	encBare, err := bare.B64Encode()
+	if err != nil {
+		t.Fatalf("couldn't encode the bare PSBT: %s", err)
+	}
+
+	wifsFile := path.Join(t.TempDir(), "wifs")
+	if err := os.WriteFile(wifsFile, []byte("cP32aiFroYrWy5BmTscPwBwaRgSavyhQtbGkV5iNYpRhohQNVuc2\n"), 0o600); err != nil {
+		t.Fatalf("couldn't write the WIF file: %s", err)
+	}
+
+	if _, err := executeCmd(t, encBare, "psbt", "sign", "--wifs", wifsFile); err == nil {
+		t.Errorf("mybtc psbt sign succeeded for a PSBT without UTXO info")
+	}
+
+	updated, err := executeCmd(t, encBare, "psbt", "update", "--input", inputFile)
+	if err != nil {
+		t.Fatalf("mybtc psbt update failed: %s", err)
+	}
+
+	if updated != created {
+		t.Errorf("mybtc psbt update returned %s, want %s", updated, created)
+	}
+
+	// legacy inputs can't be added without prevtx
+	var input tx.Input
+	if err := json.Unmarshal(b, &input); err != nil {
+		t.Fatalf("couldn't parse the input file: %s", err)
+	}
+
+	input.Ins[0].PrevTx = ""
+
+	withoutPrevTx, err := json.Marshal(input)
+	if err != nil {
+		t.Fatalf("couldn't serialize the input: %s", err)
+	}
+
+	if _, err := executeCmd(t, string(withoutPrevTx), "psbt", "create"); err == nil {
+		t.Errorf("mybtc psbt create succeeded without prevtx of a P2PKH input")
+	}
+}
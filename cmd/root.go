@@ -4,14 +4,19 @@ Package cmd provides the implementations of the main command and each subcommand
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
 
+	"github.com/3f2cm/mybtc/blockstream/bs"
 	"github.com/3f2cm/mybtc/cli"
 	"github.com/spf13/cobra"
 )
 
 // NewRootCmd will create the root command of mybtc.
 func NewRootCmd(env *cli.Env, args []string) *cobra.Command {
+	var network string
+
 	// rootCmd represents the base command when called without any subcommands
 	rootCmd := &cobra.Command{
 		Use:   "mybtc",
@@ -25,6 +30,16 @@ cf. https://github.com/btcsuite/
 		// Uncomment the following line if your bare application
 		// has an action associated with it:
 		// Run: func(cmd *cobra.Command, args []string) { },
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			net, err := cli.ParseNetwork(network)
+			if err != nil {
+				return err
+			}
+
+			env.Net = net
+
+			return nil
+		},
 	}
 	rootCmd.SetArgs(args)
 	rootCmd.SetIn(env.Stdin)
@@ -32,9 +47,29 @@ cf. https://github.com/btcsuite/
 	rootCmd.SetErr(env.Stderr)
 
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&network, "network", cli.DefaultNetwork, "network: mainnet, testnet3, signet or regtest")
+	rootCmd.PersistentFlags().StringVar(&env.Keystore, "keystore", env.Keystore, "path of the keystore file")
+	rootCmd.PersistentFlags().StringVar(&env.EsploraURL, "esplora-url", env.EsploraURL,
+		"base URL of the Esplora API (default: blockstream.info for the network or $"+bs.APIURLEnv+")")
+	rootCmd.PersistentFlags().DurationVar(&env.EsploraTimeout, "esplora-timeout", bs.DefaultTimeout, "time limit of each call to the Esplora API")
+	rootCmd.PersistentFlags().IntVar(&env.EsploraConcurrency, "esplora-concurrency", bs.DefaultConcurrency,
+		"number of calls at once to the Esplora API to retrieve transactions")
+	rootCmd.PersistentFlags().Float64Var(&env.EsploraRate, "esplora-rate", bs.DefaultRate, "limit of calls per second to the Esplora API, or no limit if it is 0")
+	rootCmd.PersistentFlags().IntVar(&env.EsploraRetries, "esplora-retries", bs.DefaultRetries,
+		"number of retries when the Esplora API is rate limited or fails by itself")
+	rootCmd.PersistentFlags().StringVar(&env.CacheDir, "cache-dir", env.CacheDir, "directory of the cache of confirmed transactions")
+	rootCmd.PersistentFlags().BoolVar(&env.NoCache, "no-cache", false, "don't use the cache of confirmed transactions")
 
 	rootCmd.AddCommand(newWIFCmd(env))
-	rootCmd.AddCommand(newTxCmd())
+	rootCmd.AddCommand(newTxCmd(env))
+	rootCmd.AddCommand(newPSBTCmd(env))
+	rootCmd.AddCommand(newHDCmd(env))
+	rootCmd.AddCommand(newMnemonicCmd(env))
+	rootCmd.AddCommand(newKeystoreCmd(env))
+	rootCmd.AddCommand(newMultisigCmd(env))
+	rootCmd.AddCommand(newMessageCmd(env))
+	rootCmd.AddCommand(newUTXOCmd(env))
+	rootCmd.AddCommand(newCacheCmd(env))
 
 	return rootCmd
 }
@@ -44,8 +79,14 @@ cf. https://github.com/btcsuite/
 func Execute(env *cli.Env, args []string) {
 	rootCmd := NewRootCmd(env, args)
 
-	err := rootCmd.Execute()
+	// Interrupting cancels the calls to APIs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
+		// os.Exit skips the deferred calls
+		stop()
 		os.Exit(1)
 	}
 }
@@ -1,16 +1,25 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
+	"github.com/3f2cm/mybtc/blockstream/bs"
+	"github.com/3f2cm/mybtc/cli"
 	"github.com/3f2cm/mybtc/tx"
 	"github.com/spf13/cobra"
 )
 
 // newTxCmd generates command for tx subcommand.
-func newTxCmd() *cobra.Command {
+func newTxCmd(env *cli.Env) *cobra.Command {
 	txCmd := &cobra.Command{
 		Use:   "tx",
 		Short: "tx manipulates transactions",
@@ -18,28 +27,41 @@ func newTxCmd() *cobra.Command {
 	}
 
 	// register subcommands
-	txCmd.AddCommand(newTxGenerateCmd())
+	txCmd.AddCommand(newTxGenerateCmd(env))
+	txCmd.AddCommand(newTxBuildCmd(env))
+	txCmd.AddCommand(newTxDecodeCmd(env))
+	txCmd.AddCommand(newTxVerifyCmd(env))
+	txCmd.AddCommand(newTxBroadcastCmd(env))
 
 	return txCmd
 }
 
-func newTxGenerateCmd() *cobra.Command {
+func newTxGenerateCmd(env *cli.Env) *cobra.Command {
+	var broadcast bool
+
 	generateCmd := &cobra.Command{
 		Use:   "generate",
-		Short: "converts given WIFs to TestNet3 Address",
-		Long:  `receives WIFs from STDIN and converts them to addresses`,
+		Short: "generates a signed transaction",
+		Long: `receives the input from STDIN and prints the signed transaction in hex
+
+With --broadcast, the signed transaction is broadcast through the Esplora API and its txid is printed instead.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			input, err := io.ReadAll(cmd.InOrStdin())
 			if err != nil {
 				return fmt.Errorf("couldn't read the input: %w", err)
 			}
 
-			t, err := tx.Generate(input)
+			t, err := tx.Generate(input, env.Net, env.Passphrase, keystoreKey(env))
 			if err != nil {
 				return fmt.Errorf("couldn't generate signed transaction from input: %w", err)
 			}
 
 			h := hex.EncodeToString(t)
+
+			if broadcast {
+				return broadcastTx(cmd, env, h)
+			}
+
 			cmd.Println(h)
 
 			return nil
@@ -47,5 +69,380 @@ func newTxGenerateCmd() *cobra.Command {
 		SilenceUsage: true,
 	}
 
+	generateCmd.Flags().BoolVar(&broadcast, "broadcast", false, "broadcast the signed transaction and print its txid")
+
 	return generateCmd
 }
+
+func newTxBroadcastCmd(env *cli.Env) *cobra.Command {
+	broadcastCmd := &cobra.Command{
+		Use:   "broadcast",
+		Short: "broadcasts a raw transaction",
+		Long: `receives a raw transaction in hex from STDIN, broadcasts it through the Esplora API and prints its txid
+
+The reason is printed if the transaction is rejected.
+The API is the one of blockstream.info by default, and can be changed with --esplora-url.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rawTx, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("couldn't read the transaction: %w", err)
+			}
+
+			return broadcastTx(cmd, env, string(rawTx))
+		},
+		SilenceUsage: true,
+	}
+
+	return broadcastCmd
+}
+
+// esploraClient returns the client of the Esplora API for the network with the flags.
+func esploraClient(env *cli.Env) (*bs.Client, error) {
+	c, err := bs.NewClient(env.Net)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't use the Esplora API: %w", err)
+	}
+
+	if env.EsploraURL != "" {
+		c.BaseURL = env.EsploraURL
+	}
+
+	c.Timeout = env.EsploraTimeout
+	c.Concurrency = env.EsploraConcurrency
+	c.Limiter = bs.NewLimiter(env.EsploraRate, env.EsploraConcurrency)
+	c.Retries = env.EsploraRetries
+	c.Cache = txCache(env)
+
+	return c, nil
+}
+
+// broadcastTx broadcasts the raw transaction in hex and prints its txid.
+func broadcastTx(cmd *cobra.Command, env *cli.Env, rawTx string) error {
+	c, err := esploraClient(env)
+	if err != nil {
+		return err
+	}
+
+	txid, err := c.Broadcast(cmd.Context(), rawTx)
+	if err != nil {
+		return fmt.Errorf("couldn't broadcast the transaction: %w", err)
+	}
+
+	cmd.Println(txid)
+
+	return nil
+}
+
+func newTxBuildCmd(env *cli.Env) *cobra.Command {
+	var (
+		utxosFile string
+		payees    []string
+		feeRate   float64
+		change    string
+		wifsFile  string
+		sign      bool
+	)
+
+	buildCmd := &cobra.Command{
+		Use:   "build",
+		Short: "builds the input of tx generate by choosing UTXOs",
+		Long: `chooses UTXOs to spend from the file given with --utxos for the payees given with --to addr:amount,
+and prints the input of tx generate, or the signed transaction with --sign.
+
+The UTXO file is a JSON array of txid, vout, scriptpubkey and value,
+or the output of utxo list --format json with the array in "utxos".
+UTXOs are chosen to avoid a change output if possible, and otherwise the change goes to --change.
+The WIFs given with --wifs are not printed, and "wifs" of the input is left empty to be filled before tx generate.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sign && wifsFile == "" {
+				return errSignWithoutWIFs
+			}
+
+			b := &tx.BuildInput{
+				FeeRate: feeRate,
+				Change:  change,
+			}
+
+			utxos, err := os.ReadFile(utxosFile)
+			if err != nil {
+				return fmt.Errorf("couldn't read the UTXO file: %w", err)
+			}
+
+			b.UTXOs, err = parseUTXOs(utxos)
+			if err != nil {
+				return err
+			}
+
+			for _, p := range payees {
+				out, err := parsePayee(p)
+				if err != nil {
+					return err
+				}
+
+				b.Outs = append(b.Outs, out)
+			}
+
+			if wifsFile != "" {
+				f, err := os.Open(wifsFile)
+				if err != nil {
+					return fmt.Errorf("couldn't open the WIF file: %w", err)
+				}
+				//nolint:errcheck // nothing to do at error
+				defer f.Close()
+
+				b.WIFs, err = readLines(f)
+				if err != nil {
+					return fmt.Errorf("couldn't read the WIF file: %w", err)
+				}
+			}
+
+			input, err := tx.Build(b, env.Net, env.Passphrase)
+			if err != nil {
+				return fmt.Errorf("couldn't build the input: %w", err)
+			}
+
+			// WIFs are not printed, and only used to sign or to estimate the sizes of inputs
+			if !sign {
+				input.WIFs = []string{}
+			}
+
+			j, err := json.MarshalIndent(input, "", "    ")
+			if err != nil {
+				return fmt.Errorf("couldn't serialize the input: %w", err)
+			}
+
+			if !sign {
+				cmd.Println(string(j))
+
+				return nil
+			}
+
+			t, err := tx.Generate(j, env.Net, env.Passphrase, keystoreKey(env))
+			if err != nil {
+				return fmt.Errorf("couldn't generate signed transaction from input: %w", err)
+			}
+
+			cmd.Println(hex.EncodeToString(t))
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	buildCmd.Flags().StringVar(&utxosFile, "utxos", "", "file of UTXOs to spend")
+	buildCmd.Flags().StringArrayVar(&payees, "to", nil, "payee as addr:amount in satoshi, can be repeated")
+	buildCmd.Flags().Float64Var(&feeRate, "feerate", 0, "fee rate in sat/vB")
+	buildCmd.Flags().StringVar(&change, "change", "", "address to receive the change")
+	buildCmd.Flags().StringVar(&wifsFile, "wifs", "", "file of WIFs, one WIF per line")
+	buildCmd.Flags().BoolVar(&sign, "sign", false, "print the signed transaction instead of the input")
+
+	for _, f := range []string{"utxos", "to", "feerate", "change"} {
+		//nolint:errcheck // the flag surely exists
+		buildCmd.MarkFlagRequired(f)
+	}
+
+	return buildCmd
+}
+
+// parseUTXOs parses the UTXO file of tx build, which is an array or an object with the array in "utxos".
+func parseUTXOs(b []byte) ([]tx.In, error) {
+	var list struct {
+		UTXOs []tx.In `json:"utxos"`
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		if err := json.Unmarshal(b, &list); err != nil {
+			return nil, fmt.Errorf("couldn't parse the UTXO file: %w", err)
+		}
+
+		return list.UTXOs, nil
+	}
+
+	if err := json.Unmarshal(b, &list.UTXOs); err != nil {
+		return nil, fmt.Errorf("couldn't parse the UTXO file: %w", err)
+	}
+
+	return list.UTXOs, nil
+}
+
+func newTxDecodeCmd(env *cli.Env) *cobra.Command {
+	var asJSON bool
+
+	decodeCmd := &cobra.Command{
+		Use:   "decode",
+		Short: "decodes a raw transaction",
+		Long: `receives a raw transaction in hex from STDIN and prints its breakdown
+such as the inputs, the outputs, the txid, the wtxid and the sizes
+
+With --json, it is printed in the same shape as decoderawtransaction of bitcoind.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rawTx, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("couldn't read the transaction: %w", err)
+			}
+
+			d, err := tx.Decode(string(rawTx), env.Net)
+			if err != nil {
+				return fmt.Errorf("couldn't decode the transaction: %w", err)
+			}
+
+			if !asJSON {
+				printDecodedTx(cmd.OutOrStdout(), d)
+
+				return nil
+			}
+
+			j, err := json.MarshalIndent(d, "", "    ")
+			if err != nil {
+				return fmt.Errorf("couldn't serialize the transaction: %w", err)
+			}
+
+			cmd.Println(string(j))
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	decodeCmd.Flags().BoolVar(&asJSON, "json", false, "print the transaction as JSON")
+
+	return decodeCmd
+}
+
+func newTxVerifyCmd(env *cli.Env) *cobra.Command {
+	var inputFile string
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "verifies the signatures of a raw transaction",
+		Long: `receives a raw transaction in hex from STDIN, runs the script engine for each input
+against the previous outputs in the input file of tx generate given with --input, and prints the results
+
+It fails if any input fails, and the failing opcode is printed as "<script index>:<opcode index>: <opcode>".
+The values of "ins" are required for SegWit inputs, and for every input when any of them spends a taproot output.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := os.ReadFile(inputFile)
+			if err != nil {
+				return fmt.Errorf("couldn't read the input file: %w", err)
+			}
+
+			var input tx.Input
+			if err := json.Unmarshal(b, &input); err != nil {
+				return fmt.Errorf("couldn't parse the input file: %w", err)
+			}
+
+			rawTx, err := io.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("couldn't read the transaction: %w", err)
+			}
+
+			results, err := tx.Verify(string(rawTx), input.Ins)
+			if err != nil {
+				return fmt.Errorf("couldn't verify the transaction: %w", err)
+			}
+
+			failed := 0
+
+			for _, r := range results {
+				switch {
+				case r.OK:
+					cmd.Printf("input #%d %s: ok\n", r.Index, r.OutPoint)
+				case r.Opcode != "":
+					cmd.Printf("input #%d %s: failed at %s: %s\n", r.Index, r.OutPoint, r.Opcode, r.Error)
+				default:
+					cmd.Printf("input #%d %s: failed: %s\n", r.Index, r.OutPoint, r.Error)
+				}
+
+				if !r.OK {
+					failed++
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%w: %d of %d", errVerifyFailed, failed, len(results))
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	verifyCmd.Flags().StringVar(&inputFile, "input", "", "input file of tx generate with the previous outputs")
+	//nolint:errcheck // the flag surely exists
+	verifyCmd.MarkFlagRequired("input")
+
+	return verifyCmd
+}
+
+// printDecodedTx prints the breakdown of a transaction with aligned labels.
+func printDecodedTx(out io.Writer, d *tx.Decoded) {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(w, "txid:\t%s\n", d.TxID)
+	fmt.Fprintf(w, "wtxid:\t%s\n", d.Hash)
+	fmt.Fprintf(w, "version:\t%d\n", d.Version)
+	fmt.Fprintf(w, "locktime:\t%d\n", d.LockTime)
+	fmt.Fprintf(w, "size:\t%d\n", d.Size)
+	fmt.Fprintf(w, "vsize:\t%d\n", d.VSize)
+	fmt.Fprintf(w, "weight:\t%d\n", d.Weight)
+
+	for i, in := range d.Vin {
+		if in.Coinbase != "" {
+			fmt.Fprintf(w, "input #%d:\tcoinbase %s\n", i, in.Coinbase)
+		} else {
+			fmt.Fprintf(w, "input #%d:\t%s:%d\n", i, in.TxID, *in.Vout)
+		}
+
+		if in.ScriptSig != nil && in.ScriptSig.Hex != "" {
+			fmt.Fprintf(w, "  scriptSig:\t%s\n", in.ScriptSig.Asm)
+		}
+
+		for j, item := range in.Witness {
+			if item == "" {
+				// e.g. the dummy item for OP_CHECKMULTISIG
+				item = "<empty>"
+			}
+
+			fmt.Fprintf(w, "  witness #%d:\t%s\n", j, item)
+		}
+
+		fmt.Fprintf(w, "  sequence:\t%d\n", in.Sequence)
+	}
+
+	for _, out := range d.Vout {
+		fmt.Fprintf(w, "output #%d:\t%s BTC\n", out.N, strconv.FormatFloat(out.Value, 'f', -1, 64))
+
+		if out.ScriptPubKey.Address != "" {
+			fmt.Fprintf(w, "  address:\t%s\n", out.ScriptPubKey.Address)
+		}
+
+		fmt.Fprintf(w, "  type:\t%s\n", out.ScriptPubKey.Type)
+		fmt.Fprintf(w, "  scriptPubKey:\t%s\n", out.ScriptPubKey.Asm)
+	}
+
+	//nolint:errcheck // the writer is a buffer or STDOUT
+	w.Flush()
+}
+
+var (
+	errSignWithoutWIFs = errors.New("--wifs is required to sign")
+	errVerifyFailed    = errors.New("some inputs failed verification")
+)
+
+// parsePayee parses a payee in the form of addr:amount.
+func parsePayee(s string) (tx.Out, error) {
+	addr, amount, ok := strings.Cut(s, ":")
+	if !ok || addr == "" {
+		return tx.Out{}, fmt.Errorf("payee '%s' is not in the form of addr:amount", s)
+	}
+
+	value, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || value <= 0 {
+		return tx.Out{}, fmt.Errorf("amount of payee '%s' is not a positive integer in satoshi", s)
+	}
+
+	return tx.Out{Addr: addr, Value: value}, nil
+}
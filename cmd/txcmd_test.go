@@ -2,13 +2,26 @@ package cmd_test
 
 import (
 	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/3f2cm/mybtc/blockstream/bs"
 	"github.com/3f2cm/mybtc/cli"
 	"github.com/3f2cm/mybtc/cmd"
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
 )
 
 func Test_newTxGenerateCmd(t *testing.T) {
@@ -33,6 +46,55 @@ func Test_newTxGenerateCmd(t *testing.T) {
 			wantTxFile: "sample_2_tx.txt",
 			err:        false,
 		},
+		{
+			name:       "sample 3 (P2WPKH and P2PKH)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_3_input.json",
+			wantTxFile: "sample_3_tx.txt",
+			err:        false,
+		},
+		{
+			name:       "sample 4 (P2TR and P2WPKH)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_4_input.json",
+			wantTxFile: "sample_4_tx.txt",
+			err:        false,
+		},
+		{
+			name:       "sample 5 (P2SH-P2WPKH and P2WPKH)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_5_input.json",
+			wantTxFile: "sample_5_tx.txt",
+			err:        false,
+		},
+		{
+			name:       "sample 6 (P2PKH with prevtx and P2SH-P2WPKH)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_6_input.json",
+			wantTxFile: "sample_6_tx.txt",
+			err:        false,
+		},
+		{
+			name:       "sample 7 (P2WPKH to compressed P2PKH)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_7_input.json",
+			wantTxFile: "sample_7_tx.txt",
+			err:        false,
+		},
+		{
+			name:       "sample 8 (compressed P2PKH)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_8_input.json",
+			wantTxFile: "sample_8_tx.txt",
+			err:        false,
+		},
+		{
+			name:       "sample 9 (2-of-3 P2WSH, P2SH-P2WSH and P2SH multisig)",
+			args:       []string{"tx", "generate"},
+			inputFile:  "sample_9_input.json",
+			wantTxFile: "sample_9_tx.txt",
+			err:        false,
+		},
 	}
 	for _, tt := range tests {
 		input, err := os.ReadFile(path.Join("test_data", tt.inputFile))
@@ -67,3 +129,831 @@ func Test_newTxGenerateCmd(t *testing.T) {
 		})
 	}
 }
+
+// Test_newTxGenerateCmdRoundTrip checks that generated transactions have the expected txids
+// and that every signed input is accepted by the script engine.
+func Test_newTxGenerateCmdRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		inputFile  string
+		wantIDFile string
+	}{
+		{
+			name:       "sample 1",
+			inputFile:  "sample_1_input.json",
+			wantIDFile: "sample_1_txid.txt",
+		},
+		{
+			name:       "sample 2",
+			inputFile:  "sample_2_input.json",
+			wantIDFile: "sample_2_txid.txt",
+		},
+		{
+			name:       "sample 3 (P2WPKH and P2PKH)",
+			inputFile:  "sample_3_input.json",
+			wantIDFile: "sample_3_txid.txt",
+		},
+		{
+			name:       "sample 4 (P2TR and P2WPKH)",
+			inputFile:  "sample_4_input.json",
+			wantIDFile: "sample_4_txid.txt",
+		},
+		{
+			name:       "sample 5 (P2SH-P2WPKH and P2WPKH)",
+			inputFile:  "sample_5_input.json",
+			wantIDFile: "sample_5_txid.txt",
+		},
+		{
+			name:       "sample 6 (P2PKH with prevtx and P2SH-P2WPKH)",
+			inputFile:  "sample_6_input.json",
+			wantIDFile: "sample_6_txid.txt",
+		},
+		{
+			name:       "sample 7 (P2WPKH to compressed P2PKH)",
+			inputFile:  "sample_7_input.json",
+			wantIDFile: "sample_7_txid.txt",
+		},
+		{
+			name:       "sample 8 (compressed P2PKH)",
+			inputFile:  "sample_8_input.json",
+			wantIDFile: "sample_8_txid.txt",
+		},
+		{
+			name:       "sample 9 (2-of-3 P2WSH, P2SH-P2WSH and P2SH multisig)",
+			inputFile:  "sample_9_input.json",
+			wantIDFile: "sample_9_txid.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := os.ReadFile(path.Join("test_data", tt.inputFile))
+			if err != nil {
+				t.Fatalf("couldn't read the input file %s: %s", tt.inputFile, err)
+			}
+
+			wantID, err := os.ReadFile(path.Join("test_data", tt.wantIDFile))
+			if err != nil {
+				t.Fatalf("couldn't read the txid file %s: %s", tt.wantIDFile, err)
+			}
+
+			var input tx.Input
+			if err := json.Unmarshal(b, &input); err != nil {
+				t.Fatalf("couldn't parse the input file %s: %s", tt.inputFile, err)
+			}
+
+			stdout := &bytes.Buffer{}
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdin:  bytes.NewReader(b),
+				Stdout: stdout,
+				Stderr: &bytes.Buffer{},
+			}, []string{"tx", "generate"})
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("mybtc tx generate failed: %s", err)
+			}
+
+			raw, err := hex.DecodeString(strings.TrimSpace(stdout.String()))
+			if err != nil {
+				t.Fatalf("mybtc tx generate returned a non-hex output: %s", err)
+			}
+
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+				t.Fatalf("couldn't deserialize the generated tx: %s", err)
+			}
+
+			if got := msgTx.TxHash().String(); got != strings.TrimSpace(string(wantID)) {
+				t.Errorf("generated tx has txid %s, want %s", got, wantID)
+			}
+
+			prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+			prevPubKeyScripts := make([][]byte, len(input.Ins))
+			for i, in := range input.Ins {
+				prevPubKeyScripts[i], err = hex.DecodeString(in.ScriptPubKey)
+				if err != nil {
+					t.Fatalf("couldn't decode scriptpubkey of the input %d: %s", i, err)
+				}
+				prevOutFetcher.AddPrevOut(msgTx.TxIn[i].PreviousOutPoint, wire.NewTxOut(in.Value, prevPubKeyScripts[i]))
+			}
+
+			sigHashes := txscript.NewTxSigHashes(msgTx, prevOutFetcher)
+			for i, in := range input.Ins {
+				vm, err := txscript.NewEngine(prevPubKeyScripts[i], msgTx, i, txscript.StandardVerifyFlags,
+					nil, sigHashes, in.Value, prevOutFetcher)
+				if err != nil {
+					t.Fatalf("couldn't create a script engine for the input %d: %s", i, err)
+				}
+
+				if err := vm.Execute(); err != nil {
+					t.Errorf("the input %d failed the script verification: %s", i, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_newTxGenerateCmdNetwork(t *testing.T) {
+	input, err := os.ReadFile(path.Join("test_data", "sample_1_input.json"))
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	want, err := os.ReadFile(path.Join("test_data", "sample_1_tx.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		network string
+		err     bool
+	}{
+		{
+			name:    "testnet3",
+			network: "testnet3",
+		},
+		{
+			name:    "regtest shares the prefixes with testnet3",
+			network: "regtest",
+		},
+		{
+			name:    "WIFs and addresses for another network",
+			network: "mainnet",
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, string(input), "tx", "generate", "--network", tt.network)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if !tt.err && got != string(want) {
+				t.Errorf("mybtc tx generate returned %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+// Test_newTxGenerateCmdBIP38 checks that BIP38 encrypted keys in wifs sign as the WIFs do.
+func Test_newTxGenerateCmdBIP38(t *testing.T) {
+	input, err := os.ReadFile(path.Join("test_data", "sample_7_input.json"))
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	want, err := os.ReadFile(path.Join("test_data", "sample_7_tx.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	// cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk encrypted with TestingOneTwoThree
+	encrypted := strings.Replace(string(input), "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk",
+		"6PYWRqmVjc6EHAn9ha1fXjH8wNBDZzdaLKfXjF8NHRCDRdFkqzeZcRWTaX", 1)
+
+	tests := []struct {
+		name       string
+		passphrase string
+		prompt     func(string) (string, error)
+		want       string
+		err        bool
+	}{
+		{
+			name:       "passphrase from the environment variable",
+			passphrase: "TestingOneTwoThree",
+			want:       string(want),
+		},
+		{
+			name:   "passphrase from the prompt",
+			prompt: func(string) (string, error) { return "TestingOneTwoThree", nil },
+			want:   string(want),
+		},
+		{
+			name:       "wrong passphrase",
+			passphrase: "TestingOneTwoThre",
+			err:        true,
+		},
+		{
+			name: "no passphrase",
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{}
+			if tt.passphrase != "" {
+				vars[cli.PassphraseEnv] = tt.passphrase
+			}
+
+			stdout := &bytes.Buffer{}
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdin:     strings.NewReader(encrypted),
+				Stdout:    stdout,
+				Stderr:    &bytes.Buffer{},
+				Prompt:    tt.prompt,
+				LookupEnv: lookupEnv(vars),
+			}, []string{"tx", "generate"})
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("mybtc tx generate returned %s, want %s", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newTxGenerateCmdFee(t *testing.T) {
+	ins := `[
+		{
+			"txid": "0b417f75700309d496dd7acfbcba92fff2c5aa7f78f30df028ab0ce9924c1d61",
+			"vout": 1,
+			"scriptpubkey": "5120e45142751814061e70de1e83d1ddee72466bca2522fb4b5f987ce495d7ea3cf6",
+			"value": 500000
+		},
+		{
+			"txid": "8010034ddd45533339867486469ee4b1fbb25fd175929b8ef54c8a1c150a6442",
+			"vout": 0,
+			"scriptpubkey": "00143e8db660656bce5d2079c9142f9a486c07a9690a",
+			"value": 2000000
+		}
+	]`
+	wifs := `["cVptxTqUZCh9KrByXhvXn8dEGDpTLaXeo9HY435DS5fpEn6if3jg", "cUP3ovDzMfxdYsr2TmpAzFzbYYeFSP2fLEka7etjEgi4ci7u2TNi"]`
+	inValue := int64(2500000)
+
+	tests := []struct {
+		name     string
+		outValue int64
+		extra    string
+		wantOuts int
+		err      bool
+	}{
+		{
+			name:     "with change",
+			outValue: 2400000,
+			extra:    `"feerate": 2, "change": "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"`,
+			wantOuts: 2,
+		},
+		{
+			name:     "with fractional fee rate",
+			outValue: 1000000,
+			extra:    `"feerate": 1.5, "change": "mj9tUkHkjRMHCJvZwNFwMi1doV5kX7u8wy"`,
+			wantOuts: 2,
+		},
+		{
+			name:     "dust change is dropped",
+			outValue: 2499500,
+			extra:    `"feerate": 2, "change": "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"`,
+			wantOuts: 1,
+		},
+		{
+			name:     "insufficient input",
+			outValue: 2499900,
+			extra:    `"feerate": 2, "change": "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"`,
+			err:      true,
+		},
+		{
+			name:     "change address for another network",
+			outValue: 2400000,
+			extra:    `"feerate": 2, "change": "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"`,
+			err:      true,
+		},
+		{
+			name:     "no change address",
+			outValue: 2400000,
+			extra:    `"feerate": 2`,
+			err:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := fmt.Sprintf(`{"ins": %s, "outs": [{"addr": "tb1pkkv627d9a8p37prm49vk4mrvmj5ehnrr62xycw8hth98m2qdhvpqaqplsh", "value": %d}], "wifs": %s, %s}`,
+				ins, tt.outValue, wifs, tt.extra)
+
+			var parsed tx.Input
+			if err := json.Unmarshal([]byte(input), &parsed); err != nil {
+				t.Fatalf("couldn't parse the input: %s", err)
+			}
+
+			stdout := &bytes.Buffer{}
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdin:  strings.NewReader(input),
+				Stdout: stdout,
+				Stderr: &bytes.Buffer{},
+			}, []string{"tx", "generate"})
+
+			err := rootCmd.Execute()
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			raw, err := hex.DecodeString(strings.TrimSpace(stdout.String()))
+			if err != nil {
+				t.Fatalf("mybtc tx generate returned a non-hex output: %s", err)
+			}
+
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+				t.Fatalf("couldn't deserialize the generated tx: %s", err)
+			}
+
+			if len(msgTx.TxOut) != tt.wantOuts {
+				t.Fatalf("generated tx has %d outputs, want %d", len(msgTx.TxOut), tt.wantOuts)
+			}
+
+			outValue := int64(0)
+			for _, out := range msgTx.TxOut {
+				outValue += out.Value
+			}
+
+			fee := inValue - outValue
+			vsize := (msgTx.SerializeSizeStripped()*3 + msgTx.SerializeSize() + 3) / 4
+			minFee := int64(math.Ceil(parsed.FeeRate * float64(vsize)))
+			// estimations assume the longest signatures
+			maxFee := int64(math.Ceil(parsed.FeeRate * float64(vsize+4)))
+
+			if tt.wantOuts > 1 && (fee < minFee || fee > maxFee) {
+				t.Errorf("generated tx pays fee %d for vsize %d, want between %d and %d", fee, vsize, minFee, maxFee)
+			}
+
+			if tt.wantOuts == 1 && fee != inValue-tt.outValue {
+				t.Errorf("generated tx pays fee %d, want %d", fee, inValue-tt.outValue)
+			}
+		})
+	}
+}
+
+// Test_newTxBuildCmd checks the chosen UTXOs and that the signed transaction is accepted by the script engine.
+func Test_newTxBuildCmd(t *testing.T) {
+	utxosFile := path.Join("test_data", "utxos_1.json")
+	wifsFile := path.Join("test_data", "utxos_1_wifs.txt")
+	payee := "tb1pkkv627d9a8p37prm49vk4mrvmj5ehnrr62xycw8hth98m2qdhvpqaqplsh"
+	change := "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"
+
+	tests := []struct {
+		name       string
+		to         []string
+		feeRate    string
+		wantIns    []int64
+		wantChange bool
+		err        bool
+	}{
+		{
+			name:    "without change",
+			to:      []string{payee + ":89800"},
+			feeRate: "1",
+			wantIns: []int64{90000},
+		},
+		{
+			name:       "smallest sufficient UTXO with change",
+			to:         []string{payee + ":1000000"},
+			feeRate:    "1",
+			wantIns:    []int64{2000000},
+			wantChange: true,
+		},
+		{
+			name:       "largest UTXOs first with change",
+			to:         []string{payee + ":2000000", "mj9tUkHkjRMHCJvZwNFwMi1doV5kX7u8wy:700000"},
+			feeRate:    "2",
+			wantIns:    []int64{2000000, 500000, 300000},
+			wantChange: true,
+		},
+		{
+			name:    "insufficient UTXOs",
+			to:      []string{payee + ":3000000"},
+			feeRate: "1",
+			err:     true,
+		},
+		{
+			name:    "payee for another network",
+			to:      []string{"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4:10000"},
+			feeRate: "1",
+			err:     true,
+		},
+		{
+			name:    "malformed payee",
+			to:      []string{payee},
+			feeRate: "1",
+			err:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"tx", "build", "--utxos", utxosFile, "--feerate", tt.feeRate, "--change", change, "--wifs", wifsFile}
+			for _, to := range tt.to {
+				args = append(args, "--to", to)
+			}
+
+			out, err := executeCmd(t, "", args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if tt.err {
+				return
+			}
+
+			var input tx.Input
+			if err := json.Unmarshal([]byte(out), &input); err != nil {
+				t.Fatalf("mybtc tx build returned an invalid input: %s", err)
+			}
+
+			gotIns := []int64{}
+			for _, in := range input.Ins {
+				gotIns = append(gotIns, in.Value)
+			}
+
+			if fmt.Sprint(gotIns) != fmt.Sprint(tt.wantIns) {
+				t.Errorf("mybtc tx build chose %v, want %v", gotIns, tt.wantIns)
+			}
+
+			if (input.Change != "") != tt.wantChange {
+				t.Errorf("mybtc tx build returned change '%s', want change: %v", input.Change, tt.wantChange)
+			}
+
+			if len(input.WIFs) != 0 {
+				t.Errorf("mybtc tx build returned WIFs %v without --sign, want none", input.WIFs)
+			}
+
+			signed, err := executeCmd(t, "", append(args, "--sign")...)
+			if err != nil {
+				t.Fatalf("mybtc tx build --sign failed: %s", err)
+			}
+
+			raw, err := hex.DecodeString(strings.TrimSpace(signed))
+			if err != nil {
+				t.Fatalf("mybtc tx build --sign returned a non-hex output: %s", err)
+			}
+
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			if err := msgTx.Deserialize(bytes.NewReader(raw)); err != nil {
+				t.Fatalf("couldn't deserialize the generated tx: %s", err)
+			}
+
+			wantOuts := len(tt.to)
+			if tt.wantChange {
+				wantOuts++
+			}
+
+			if len(msgTx.TxOut) != wantOuts {
+				t.Errorf("generated tx has %d outputs, want %d", len(msgTx.TxOut), wantOuts)
+			}
+
+			prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+			prevPubKeyScripts := make([][]byte, len(input.Ins))
+			for i, in := range input.Ins {
+				prevPubKeyScripts[i], err = hex.DecodeString(in.ScriptPubKey)
+				if err != nil {
+					t.Fatalf("couldn't decode scriptpubkey of the input %d: %s", i, err)
+				}
+				prevOutFetcher.AddPrevOut(msgTx.TxIn[i].PreviousOutPoint, wire.NewTxOut(in.Value, prevPubKeyScripts[i]))
+			}
+
+			sigHashes := txscript.NewTxSigHashes(msgTx, prevOutFetcher)
+			for i, in := range input.Ins {
+				vm, err := txscript.NewEngine(prevPubKeyScripts[i], msgTx, i, txscript.StandardVerifyFlags,
+					nil, sigHashes, in.Value, prevOutFetcher)
+				if err != nil {
+					t.Fatalf("couldn't create a script engine for the input %d: %s", i, err)
+				}
+
+				if err := vm.Execute(); err != nil {
+					t.Errorf("the input %d failed the script verification: %s", i, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_newTxDecodeCmd(t *testing.T) {
+	b, err := os.ReadFile(path.Join("test_data", "sample_1_tx.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	want := `txid:           fea78f76f79ad2aa5ed06fe469556c804719aa804977b71315d705b266c749a9
+wtxid:          fea78f76f79ad2aa5ed06fe469556c804719aa804977b71315d705b266c749a9
+version:        1
+locktime:       0
+size:           257
+vsize:          257
+weight:         1028
+input #0:       204eec97c9f957e517441b56cef5a2a003162b41ffdc6e5ff1610894013d562d:1
+  scriptSig:    30440220327111114de4ceb65143f51f73b5915512f211f31bacb3934b19312a7dfd33a6022047aa55cb056fe14794fd36dde4f6ed2553eac5d19b852a2987ab9c389e060d6701 0425adade9f702a4c1e7f312ed7eb9507a6b70a6bafe6c48092137eb991d5b29eb9374edc1c6f83e0b22d5c00f26d0b163a466c45ed814c2b9b929e87ab47e8551
+  sequence:     4294967295
+output #0:      0.0048 BTC
+  address:      mj9tUkHkjRMHCJvZwNFwMi1doV5kX7u8wy
+  type:         pubkeyhash
+  scriptPubKey: OP_DUP OP_HASH160 27e49532bfeae7a40d878aa5fd2699fe9729cb25 OP_EQUALVERIFY OP_CHECKSIG
+output #1:      0.015 BTC
+  address:      mhRvRGsdLp2KHPtun51PMM3Yi5qSD3qWgi
+  type:         pubkeyhash
+  scriptPubKey: OP_DUP OP_HASH160 14fc9b2d74e76f4d7463f2a04e06040d3128e22d OP_EQUALVERIFY OP_CHECKSIG
+`
+
+	got, err := executeCmd(t, string(b), "tx", "decode")
+	if err != nil {
+		t.Fatalf("mybtc tx decode failed: %s", err)
+	}
+
+	if got != want {
+		t.Errorf("mybtc tx decode returned\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := executeCmd(t, "not a tx", "tx", "decode"); err == nil {
+		t.Errorf("mybtc tx decode succeeded for a non-hex input")
+	}
+}
+
+// Test_newTxDecodeCmdJSON checks the txids of the samples and the breakdown of the multisig one.
+func Test_newTxDecodeCmdJSON(t *testing.T) {
+	for i := 1; i <= 9; i++ {
+		b, err := os.ReadFile(path.Join("test_data", fmt.Sprintf("sample_%d_tx.txt", i)))
+		if err != nil {
+			t.Fatalf("couldn't read the tx file of sample %d: %s", i, err)
+		}
+
+		wantID, err := os.ReadFile(path.Join("test_data", fmt.Sprintf("sample_%d_txid.txt", i)))
+		if err != nil {
+			t.Fatalf("couldn't read the txid file of sample %d: %s", i, err)
+		}
+
+		got, err := executeCmd(t, string(b), "tx", "decode", "--json")
+		if err != nil {
+			t.Fatalf("mybtc tx decode --json failed for sample %d: %s", i, err)
+		}
+
+		var d tx.Decoded
+		if err := json.Unmarshal([]byte(got), &d); err != nil {
+			t.Fatalf("mybtc tx decode --json returned an invalid JSON for sample %d: %s", i, err)
+		}
+
+		if d.TxID != strings.TrimSpace(string(wantID)) {
+			t.Errorf("mybtc tx decode --json returned txid %s for sample %d, want %s", d.TxID, i, wantID)
+		}
+
+		if i != 9 {
+			continue
+		}
+
+		// 2-of-3 P2WSH, P2SH-P2WSH and P2SH multisig
+		if d.Size != 964 || d.VSize != 583 || d.Weight != 2329 {
+			t.Errorf("sample 9 has size %d, vsize %d and weight %d, want 964, 583 and 2329", d.Size, d.VSize, d.Weight)
+		}
+
+		if len(d.Vin) != 3 || len(d.Vin[0].Witness) != 4 || d.Vin[0].Witness[0] != "" || d.Vin[2].Witness != nil {
+			t.Errorf("sample 9 has unexpected witnesses: %+v", d.Vin)
+		}
+
+		if d.Vin[1].ScriptSig.Asm != "0020fd61bf94b8e00338a55afcd4cbe3b25cff36b978fd8d57976f776bfcef045bc5" {
+			t.Errorf("sample 9 has the scriptSig %s for the P2SH-P2WSH input", d.Vin[1].ScriptSig.Asm)
+		}
+
+		out := d.Vout[0]
+		if out.Value != 0.00599 || out.ScriptPubKey.Address != "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww" ||
+			out.ScriptPubKey.Type != "witness_v0_keyhash" {
+			t.Errorf("sample 9 has the unexpected output: %+v", out)
+		}
+	}
+}
+
+func Test_newTxVerifyCmd(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample int
+		modify func(input *tx.Input)
+		rawTx  func(t *testing.T, input tx.Input) string
+		want   string
+		err    bool
+	}{
+		{
+			name:   "P2PKH",
+			sample: 1,
+			want:   "input #0 204eec97c9f957e517441b56cef5a2a003162b41ffdc6e5ff1610894013d562d:1: ok\n",
+		},
+		{
+			name:   "P2TR and P2WPKH",
+			sample: 4,
+			want: "input #0 0b417f75700309d496dd7acfbcba92fff2c5aa7f78f30df028ab0ce9924c1d61:1: ok\n" +
+				"input #1 8010034ddd45533339867486469ee4b1fbb25fd175929b8ef54c8a1c150a6442:0: ok\n",
+		},
+		{
+			name:   "P2SH-P2WPKH with a wrong value",
+			sample: 5,
+			modify: func(input *tx.Input) { input.Ins[0].Value++ },
+			want: "input #0 f2e2572cd02a72369d6cb67459d46d19d96f89e0dc0e81fe2290712205fb17d8:0: " +
+				"failed at 03:0004: OP_CHECKSIG: signature not empty on failed checksig\n" +
+				"input #1 1d77416fcbb710cf2fead24a59e614e499507cc6eea309756a5149e552d4936b:1: ok\n",
+			err: true,
+		},
+		{
+			name:   "P2PKH signed for another public key",
+			sample: 1,
+			modify: func(input *tx.Input) {
+				// the hash of another public key
+				input.Ins[0].ScriptPubKey = "76a914" + "3e73b512900677abbff836104829b733de821867" + "88ac"
+			},
+			want: "input #0 204eec97c9f957e517441b56cef5a2a003162b41ffdc6e5ff1610894013d562d:1: " +
+				"failed at 01:0003: OP_EQUALVERIFY: OP_EQUALVERIFY failed\n",
+			err: true,
+		},
+		{
+			name:   "multisig signed partially",
+			sample: 9,
+			rawTx: func(t *testing.T, input tx.Input) string {
+				t.Helper()
+
+				input.WIFs = input.WIFs[:1]
+
+				return generateTx(t, input)
+			},
+			want: "input #0 03b7a1c4f1e0b5d2c6a9f8e7d6c5b4a3928170615f4e3d2c1b0a998877665544:0: " +
+				"failed at 02:0005: OP_CHECKMULTISIG: index 0 is invalid for stack size 0\n" +
+				"input #1 03b7a1c4f1e0b5d2c6a9f8e7d6c5b4a3928170615f4e3d2c1b0a998877665544:1: " +
+				"failed at 03:0005: OP_CHECKMULTISIG: index 0 is invalid for stack size 0\n" +
+				"input #2 03b7a1c4f1e0b5d2c6a9f8e7d6c5b4a3928170615f4e3d2c1b0a998877665544:2: " +
+				"failed at 02:0005: OP_CHECKMULTISIG: index 0 is invalid for stack size 0\n",
+			err: true,
+		},
+		{
+			name:   "missing previous output",
+			sample: 4,
+			modify: func(input *tx.Input) { input.Ins = input.Ins[:1] },
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := os.ReadFile(path.Join("test_data", fmt.Sprintf("sample_%d_input.json", tt.sample)))
+			if err != nil {
+				t.Fatalf("couldn't read the input file: %s", err)
+			}
+
+			var input tx.Input
+			if err := json.Unmarshal(b, &input); err != nil {
+				t.Fatalf("couldn't parse the input file: %s", err)
+			}
+
+			rawTx, err := os.ReadFile(path.Join("test_data", fmt.Sprintf("sample_%d_tx.txt", tt.sample)))
+			if err != nil {
+				t.Fatalf("couldn't read the tx file: %s", err)
+			}
+
+			if tt.rawTx != nil {
+				rawTx = []byte(tt.rawTx(t, input))
+			}
+
+			if tt.modify != nil {
+				tt.modify(&input)
+			}
+
+			inputFile := path.Join(t.TempDir(), "input.json")
+			if err := os.WriteFile(inputFile, []byte(marshalInput(t, input)), 0o600); err != nil {
+				t.Fatalf("couldn't write the input file: %s", err)
+			}
+
+			got, err := executeCmd(t, string(rawTx), "tx", "verify", "--input", inputFile)
+			if (err != nil) != tt.err {
+				t.Fatalf("mybtc tx verify returned error %v, want error %v", err, tt.err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc tx verify returned\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// newEsploraServer starts a stand-in of the Esplora API accepting only the transaction in the tx file.
+func newEsploraServer(t *testing.T, txFile string) *httptest.Server {
+	t.Helper()
+
+	rawTx, err := os.ReadFile(path.Join("test_data", txFile))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the API under /slow responds slowly
+		if strings.HasPrefix(r.URL.Path, "/slow/") {
+			time.Sleep(500 * time.Millisecond)
+
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, "/slow")
+		}
+
+		if r.Method != http.MethodPost || r.URL.Path != "/tx" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		if r.UserAgent() != bs.DefaultUserAgent {
+			t.Errorf("the request has User-Agent %q, want %q", r.UserAgent(), bs.DefaultUserAgent)
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil || string(b) != strings.TrimSpace(string(rawTx)) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `sendrawtransaction RPC error: {"code":-26,"message":"mandatory-script-verify-flag-failed"}`)
+
+			return
+		}
+
+		d, err := tx.Decode(string(b), &chaincfg.TestNet3Params)
+		if err != nil {
+			t.Errorf("couldn't decode the posted transaction: %s", err)
+		}
+
+		fmt.Fprint(w, d.TxID)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func Test_newTxBroadcastCmd(t *testing.T) {
+	srv := newEsploraServer(t, "sample_4_tx.txt")
+	// the default API is replaced by the environment variable, or by --esplora-url
+	t.Setenv(bs.APIURLEnv, "http://localhost:1")
+
+	rawTx, err := os.ReadFile(path.Join("test_data", "sample_4_tx.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the tx file: %s", err)
+	}
+
+	wantID, err := os.ReadFile(path.Join("test_data", "sample_4_txid.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read the txid file: %s", err)
+	}
+
+	input, err := os.ReadFile(path.Join("test_data", "sample_4_input.json"))
+	if err != nil {
+		t.Fatalf("couldn't read the input file: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "broadcast",
+			args:  []string{"tx", "broadcast", "--esplora-url", srv.URL},
+			stdin: string(rawTx),
+			want:  strings.TrimSpace(string(wantID)) + "\n",
+		},
+		{
+			name:  "generate and broadcast",
+			args:  []string{"tx", "generate", "--broadcast", "--esplora-url", srv.URL + "/"},
+			stdin: string(input),
+			want:  strings.TrimSpace(string(wantID)) + "\n",
+		},
+		{
+			name:    "rejected",
+			args:    []string{"tx", "broadcast", "--esplora-url", srv.URL},
+			stdin:   strings.TrimSpace(string(rawTx)) + "00",
+			wantErr: "the transaction was rejected: mandatory-script-verify-flag-failed (code -26)",
+		},
+		{
+			name:    "timeout",
+			args:    []string{"tx", "broadcast", "--esplora-url", srv.URL + "/slow", "--esplora-timeout", "100ms"},
+			stdin:   string(rawTx),
+			wantErr: "context deadline exceeded",
+		},
+		{
+			name:    "default API from the environment variable",
+			args:    []string{"tx", "broadcast"},
+			stdin:   string(rawTx),
+			wantErr: "localhost:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, tt.stdin, tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("mybtc %s returned error %v, want %s", strings.Join(tt.args, " "), err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("mybtc %s failed: %s", strings.Join(tt.args, " "), err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc %s returned %q, want %q", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
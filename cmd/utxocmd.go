@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/3f2cm/mybtc/blockstream/bs"
+	"github.com/3f2cm/mybtc/cli"
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errUnknownFormat = errors.New("unknown format; use table, json or csv")
+	errUnknownSort   = errors.New("unknown sort key; use value, confirmations or txid")
+	errNoUTXOs       = errors.New("there are no UTXOs of the addresses")
+)
+
+// utxoList is the UTXOs printed by utxo list --format json with their total value in satoshi.
+type utxoList struct {
+	UTXOs []addrUTXO `json:"utxos"`
+	Total uint64     `json:"total"`
+}
+
+// addrUTXO is a UTXO of an address with the number of its confirmations.
+type addrUTXO struct {
+	Address string `json:"address"`
+	bs.VinSummary
+	Confirmations int64 `json:"confirmations"`
+}
+
+// newUTXOCmd generates command for utxo subcommand.
+func newUTXOCmd(env *cli.Env) *cobra.Command {
+	utxoCmd := &cobra.Command{
+		Use:   "utxo",
+		Short: "utxo retrieves UTXOs of addresses from the Esplora API",
+		Long: `utxo command retrieves UTXOs of addresses from the Esplora API given with --esplora-url
+(blockstream.info for the network by default).
+
+For addresses with too many history entries for the UTXO endpoint,
+the UTXOs are reconstructed from all the pages of their transactions.`,
+	}
+
+	// register subcommands
+	utxoCmd.AddCommand(newUTXOListCmd(env))
+	utxoCmd.AddCommand(newUTXOToInputCmd(env))
+
+	return utxoCmd
+}
+
+func newUTXOListCmd(env *cli.Env) *cobra.Command {
+	var (
+		minConf int64
+		sortKey string
+		format  string
+	)
+
+	listCmd := &cobra.Command{
+		Use:   "list <address>...",
+		Short: "lists UTXOs of addresses",
+		Long: `lists UTXOs of the addresses with the number of confirmations, and prints the total value in satoshi
+
+UTXOs with fewer confirmations than --min-conf are omitted, and unconfirmed ones are included by default.
+They are in the order of the API, or sorted with --sort value (largest first), confirmations (most first) or txid.
+--format json prints a JSON object of "utxos" and "total", which is also accepted as the UTXO file of tx build,
+and csv prints CSV with the total in the last row.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format != "table" && format != "json" && format != "csv" {
+				return fmt.Errorf("%w: %s", errUnknownFormat, format)
+			}
+
+			less, ok := utxoLess[sortKey]
+			if sortKey != "" && !ok {
+				return fmt.Errorf("%w: %s", errUnknownSort, sortKey)
+			}
+
+			c, err := esploraClient(env)
+			if err != nil {
+				return err
+			}
+
+			utxos, err := listUTXOs(cmd.Context(), c, args, minConf)
+			if err != nil {
+				return err
+			}
+
+			// The order of the API is kept for the same ones
+			if less != nil {
+				sort.SliceStable(utxos, func(i, j int) bool { return less(utxos[i], utxos[j]) })
+			}
+
+			switch format {
+			case "json":
+				b, err := json.MarshalIndent(utxoList{UTXOs: utxos, Total: totalValue(utxos)}, "", "    ")
+				if err != nil {
+					return fmt.Errorf("couldn't serialize the UTXOs: %w", err)
+				}
+
+				cmd.Println(string(b))
+			case "csv":
+				return writeUTXOsCSV(cmd.OutOrStdout(), utxos)
+			default:
+				printUTXOs(cmd.OutOrStdout(), utxos)
+			}
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	listCmd.Flags().Int64Var(&minConf, "min-conf", 0, "minimum number of confirmations")
+	listCmd.Flags().StringVar(&sortKey, "sort", "", "sort key: value, confirmations or txid")
+	listCmd.Flags().StringVar(&format, "format", "table", "output format: table, json or csv")
+
+	return listCmd
+}
+
+func newUTXOToInputCmd(env *cli.Env) *cobra.Command {
+	var (
+		payees  []string
+		change  string
+		feeRate float64
+		minConf int64
+	)
+
+	toInputCmd := &cobra.Command{
+		Use:   "to-input <address>...",
+		Short: "prints the input of tx generate spending UTXOs of addresses",
+		Long: `retrieves UTXOs of the addresses, and prints the input of tx generate spending all of them
+for the payees given with --to addr:amount with the change to --change at --feerate
+
+"wifs" is left empty to be filled with WIFs, or "keys" with labels in the keystore, before tx generate.
+UTXOs with fewer confirmations than --min-conf are omitted.
+Use utxo list --format json and tx build instead to spend only some of them.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input := &tx.Input{
+				WIFs:    []string{},
+				FeeRate: feeRate,
+				Change:  change,
+			}
+
+			for _, p := range payees {
+				out, err := parsePayee(p)
+				if err != nil {
+					return err
+				}
+
+				input.Outs = append(input.Outs, out)
+			}
+
+			c, err := esploraClient(env)
+			if err != nil {
+				return err
+			}
+
+			utxos, err := listUTXOs(cmd.Context(), c, args, minConf)
+			if err != nil {
+				return err
+			}
+
+			if len(utxos) == 0 {
+				return errNoUTXOs
+			}
+
+			for _, u := range utxos {
+				input.Ins = append(input.Ins, tx.In{
+					TxID:         u.TxID,
+					Vout:         u.Vout,
+					ScriptPubKey: u.ScriptPubKey,
+					Value:        int64(u.Value),
+				})
+			}
+
+			j, err := json.MarshalIndent(input, "", "    ")
+			if err != nil {
+				return fmt.Errorf("couldn't serialize the input: %w", err)
+			}
+
+			cmd.Println(string(j))
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	toInputCmd.Flags().StringArrayVar(&payees, "to", nil, "payee as addr:amount in satoshi, can be repeated")
+	toInputCmd.Flags().StringVar(&change, "change", "", "address to receive the change")
+	toInputCmd.Flags().Float64Var(&feeRate, "feerate", 1, "fee rate in sat/vB")
+	toInputCmd.Flags().Int64Var(&minConf, "min-conf", 0, "minimum number of confirmations")
+
+	for _, f := range []string{"to", "change"} {
+		//nolint:errcheck // the flag surely exists
+		toInputCmd.MarkFlagRequired(f)
+	}
+
+	return toInputCmd
+}
+
+// listUTXOs retrieves the UTXOs of the addresses with at least minConf confirmations.
+// Repeated addresses are looked up once not to list the same UTXOs twice.
+func listUTXOs(ctx context.Context, c *bs.Client, addrs []string, minConf int64) ([]addrUTXO, error) {
+	tip, err := c.GetTipHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := []addrUTXO{}
+	seen := map[string]bool{}
+
+	for _, a := range addrs {
+		if seen[a] {
+			continue
+		}
+
+		seen[a] = true
+
+		summaries, err := c.GetUTXOWithScriptPubKey(ctx, a)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get UTXOs of %s: %w", a, err)
+		}
+
+		for _, s := range summaries {
+			u := addrUTXO{Address: a, VinSummary: s}
+			if s.Status.Confirmed {
+				u.Confirmations = tip - s.Status.BlockHeight + 1
+			}
+
+			if u.Confirmations >= minConf {
+				utxos = append(utxos, u)
+			}
+		}
+	}
+
+	return utxos, nil
+}
+
+// utxoLess has the orders of UTXOs by the sort keys.
+var utxoLess = map[string]func(a, b addrUTXO) bool{
+	"value":         func(a, b addrUTXO) bool { return a.Value > b.Value },
+	"confirmations": func(a, b addrUTXO) bool { return a.Confirmations > b.Confirmations },
+	"txid": func(a, b addrUTXO) bool {
+		if a.TxID != b.TxID {
+			return a.TxID < b.TxID
+		}
+
+		return a.Vout < b.Vout
+	},
+}
+
+// printUTXOs prints the UTXOs in aligned columns and their total value.
+func printUTXOs(out io.Writer, utxos []addrUTXO) {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(w, "address\ttxid\tvout\tvalue\tconfirmations\n")
+
+	for _, u := range utxos {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\n", u.Address, u.TxID, u.Vout, u.Value, u.Confirmations)
+	}
+
+	//nolint:errcheck // the writer is a buffer or STDOUT
+	w.Flush()
+
+	fmt.Fprintf(out, "total: %d satoshi in %d UTXOs\n", totalValue(utxos), len(utxos))
+}
+
+// totalValue returns the total value of the UTXOs in satoshi.
+func totalValue(utxos []addrUTXO) uint64 {
+	total := uint64(0)
+	for _, u := range utxos {
+		total += u.Value
+	}
+
+	return total
+}
+
+// writeUTXOsCSV writes the UTXOs as CSV with the header, and their total value in the last row.
+func writeUTXOsCSV(out io.Writer, utxos []addrUTXO) error {
+	w := csv.NewWriter(out)
+
+	records := [][]string{{"address", "txid", "vout", "value", "confirmations"}}
+	for _, u := range utxos {
+		records = append(records, []string{
+			u.Address,
+			u.TxID,
+			strconv.FormatUint(uint64(u.Vout), 10),
+			strconv.FormatUint(u.Value, 10),
+			strconv.FormatInt(u.Confirmations, 10),
+		})
+	}
+
+	records = append(records, []string{"total", "", "", strconv.FormatUint(totalValue(utxos), 10), ""})
+
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("couldn't write the UTXOs as CSV: %w", err)
+	}
+
+	return nil
+}
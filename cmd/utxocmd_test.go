@@ -0,0 +1,455 @@
+package cmd_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/3f2cm/mybtc/blockstream/bs"
+	"github.com/3f2cm/mybtc/tx"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+const (
+	utxoAddr1   = "mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv"
+	utxoScript1 = "76a914b4e72e4582c8ef7f510447d90f0249ad8b29b6b788ac"
+	utxoAddr2   = "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"
+	utxoScript2 = "00143e73b512900677abbff836104829b733de821867"
+)
+
+// newUTXOServer starts a stand-in of the Esplora API at the tip height 110 with the UTXOs of the two addresses.
+// Some outputs to the addresses are spent, including one next to an unspent one to the same address.
+func newUTXOServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	confirmed := func(height int64) bs.TxStatus { return bs.TxStatus{Confirmed: true, BlockHeight: height} }
+	txs := []bs.Tx{
+		{
+			TxID:   strings.Repeat("a", 64),
+			Vout:   []bs.Vout{{ScriptPubKey: utxoScript2, ScriptPubKeyAddress: utxoAddr2, Value: 1000}, {ScriptPubKey: utxoScript1, ScriptPubKeyAddress: utxoAddr1, Value: 65403237}},
+			Status: confirmed(100),
+		},
+		{
+			TxID:   strings.Repeat("b", 64),
+			Vout:   []bs.Vout{{ScriptPubKey: utxoScript1, ScriptPubKeyAddress: utxoAddr1, Value: 6047}},
+			Status: bs.TxStatus{},
+		},
+		{
+			TxID:   strings.Repeat("c", 64),
+			Vout:   []bs.Vout{{ScriptPubKey: utxoScript2, ScriptPubKeyAddress: utxoAddr2, Value: 5000}, {ScriptPubKey: utxoScript2, ScriptPubKeyAddress: utxoAddr2, Value: 20000}, {ScriptPubKey: utxoScript1, ScriptPubKeyAddress: utxoAddr1, Value: 3000}},
+			Status: confirmed(105),
+		},
+		{
+			TxID:   strings.Repeat("1", 64),
+			Vout:   []bs.Vout{{ScriptPubKey: utxoScript1, ScriptPubKeyAddress: utxoAddr1, Value: 19460}, {ScriptPubKey: utxoScript2, ScriptPubKeyAddress: utxoAddr2, Value: 267587}},
+			Status: confirmed(110),
+		},
+	}
+
+	utxo := func(tx bs.Tx, i uint32) bs.UTXO {
+		return bs.UTXO{TxID: tx.TxID, Idx: i, Value: tx.Vout[i].Value, Status: tx.Status}
+	}
+
+	// the UTXOs of the addresses in the order of the API, where the outputs 0 and 2 of cccc... are spent
+	utxos := map[string][]bs.UTXO{
+		utxoAddr1: {utxo(txs[0], 1), utxo(txs[1], 0), utxo(txs[3], 0)},
+		utxoAddr2: {utxo(txs[0], 0), utxo(txs[2], 1), utxo(txs[3], 1)},
+	}
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+		switch {
+		case r.URL.Path == "/blocks/tip/height":
+			w.Write([]byte("110")) //nolint:errcheck // the response can't be helped at error
+
+			return
+		case len(parts) == 3 && parts[0] == "address" && parts[2] == "utxo":
+			json.NewEncoder(w).Encode(append([]bs.UTXO{}, utxos[parts[1]]...)) //nolint:errcheck,errchkjson // the response can't be helped at error
+
+			return
+		case len(parts) == 2 && parts[0] == "tx":
+			for _, tx := range txs {
+				if tx.TxID == parts[1] {
+					json.NewEncoder(w).Encode(tx) //nolint:errcheck,errchkjson // the response can't be helped at error
+
+					return
+				}
+			}
+		}
+
+		http.NotFound(w, r)
+	})
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func Test_newUTXOListCmd(t *testing.T) {
+	srv := newUTXOServer(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{
+			name: "table",
+			args: []string{"utxo", "list", utxoAddr1, utxoAddr2},
+			want: `address                                    txid                                                             vout value    confirmations
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv         aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa 1    65403237 11
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv         bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb 0    6047     0
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv         1111111111111111111111111111111111111111111111111111111111111111 0    19460    1
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa 0    1000     11
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc 1    20000    6
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww 1111111111111111111111111111111111111111111111111111111111111111 1    267587   1
+total: 65717331 satoshi in 6 UTXOs
+`,
+		},
+		{
+			name: "table with min-conf sorted by value",
+			args: []string{"utxo", "list", "--min-conf", "2", "--sort", "value", utxoAddr2, utxoAddr1},
+			want: `address                                    txid                                                             vout value    confirmations
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv         aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa 1    65403237 11
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc 1    20000    6
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa 0    1000     11
+total: 65424237 satoshi in 3 UTXOs
+`,
+		},
+		{
+			name: "CSV sorted by txid",
+			args: []string{"utxo", "list", "--format", "csv", "--sort", "txid", utxoAddr1, utxoAddr2},
+			want: `address,txid,vout,value,confirmations
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv,1111111111111111111111111111111111111111111111111111111111111111,0,19460,1
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww,1111111111111111111111111111111111111111111111111111111111111111,1,267587,1
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww,aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa,0,1000,11
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv,aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa,1,65403237,11
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv,bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb,0,6047,0
+tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww,cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc,1,20000,6
+total,,,65717331,
+`,
+		},
+		{
+			name: "CSV sorted by confirmations",
+			args: []string{"utxo", "list", "--format", "csv", "--sort", "confirmations", utxoAddr1},
+			want: `address,txid,vout,value,confirmations
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv,aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa,1,65403237,11
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv,1111111111111111111111111111111111111111111111111111111111111111,0,19460,1
+mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv,bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb,0,6047,0
+total,,,65428744,
+`,
+		},
+		{
+			name: "unknown format",
+			args: []string{"utxo", "list", "--format", "yaml", utxoAddr1},
+			err:  true,
+		},
+		{
+			name: "unknown sort key",
+			args: []string{"utxo", "list", "--sort", "age", utxoAddr1},
+			err:  true,
+		},
+		{
+			name: "address for another network",
+			args: []string{"utxo", "list", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"},
+			err:  true,
+		},
+		{
+			name: "no address",
+			args: []string{"utxo", "list"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, "", append([]string{"--esplora-url", srv.URL}, tt.args...)...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc %v returned\n%s\nwant\n%s", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newUTXOListCmdJSON checks the JSON output with the total, and that it is accepted as the UTXO file of tx build.
+func Test_newUTXOListCmdJSON(t *testing.T) {
+	srv := newUTXOServer(t)
+
+	got, err := executeCmd(t, "", "--esplora-url", srv.URL, "utxo", "list", "--format", "json", "--min-conf", "1", utxoAddr1)
+	if err != nil {
+		t.Fatalf("mybtc utxo list failed: %s", err)
+	}
+
+	var list struct {
+		UTXOs []tx.In `json:"utxos"`
+		Total int64   `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(got), &list); err != nil {
+		t.Fatalf("couldn't parse the output: %s", err)
+	}
+
+	want := []tx.In{
+		{TxID: strings.Repeat("a", 64), Vout: 1, ScriptPubKey: utxoScript1, Value: 65403237},
+		{TxID: strings.Repeat("1", 64), Vout: 0, ScriptPubKey: utxoScript1, Value: 19460},
+	}
+
+	if len(list.UTXOs) != len(want) {
+		t.Fatalf("mybtc utxo list returned %d UTXOs, want %d", len(list.UTXOs), len(want))
+	}
+
+	for i := range want {
+		if in := list.UTXOs[i]; in.TxID != want[i].TxID || in.Vout != want[i].Vout || in.ScriptPubKey != want[i].ScriptPubKey || in.Value != want[i].Value {
+			t.Errorf("mybtc utxo list returned %+v at %d, want %+v", in, i, want[i])
+		}
+	}
+
+	if list.Total != 65403237+19460 {
+		t.Errorf("mybtc utxo list returned the total %d, want %d", list.Total, 65403237+19460)
+	}
+
+	var utxos struct {
+		UTXOs []map[string]interface{} `json:"utxos"`
+	}
+	if err := json.Unmarshal([]byte(got), &utxos); err != nil {
+		t.Fatalf("couldn't parse the output: %s", err)
+	}
+
+	if u := utxos.UTXOs[0]; u["address"] != utxoAddr1 || u["confirmations"] != float64(11) {
+		t.Errorf("mybtc utxo list returned %v, want the address and the confirmations", u)
+	}
+
+	utxosFile := filepath.Join(t.TempDir(), "utxos.json")
+	if err := os.WriteFile(utxosFile, []byte(got), 0o600); err != nil {
+		t.Fatalf("couldn't write the UTXOs: %s", err)
+	}
+
+	built, err := executeCmd(t, "", "tx", "build", "--utxos", utxosFile, "--to", utxoAddr2+":19000", "--feerate", "1", "--change", utxoAddr1)
+	if err != nil {
+		t.Fatalf("mybtc tx build failed with the output of utxo list: %s", err)
+	}
+
+	var input tx.Input
+	if err := json.Unmarshal([]byte(built), &input); err != nil {
+		t.Fatalf("couldn't parse the input: %s", err)
+	}
+
+	if len(input.Ins) != 1 || input.Ins[0].Value != 19460 {
+		t.Errorf("mybtc tx build chose %+v, want the UTXO of 19460", input.Ins)
+	}
+}
+
+func Test_newUTXOToInputCmd(t *testing.T) {
+	srv := newUTXOServer(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+		err  bool
+	}{
+		{
+			name: "input",
+			args: []string{"utxo", "to-input", "--to", utxoAddr1 + ":100000", "--change", utxoAddr2, "--feerate", "2", utxoAddr2},
+			want: `{
+    "ins": [
+        {
+            "txid": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+            "vout": 0,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 1000
+        },
+        {
+            "txid": "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+            "vout": 1,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 20000
+        },
+        {
+            "txid": "1111111111111111111111111111111111111111111111111111111111111111",
+            "vout": 1,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 267587
+        }
+    ],
+    "outs": [
+        {
+            "addr": "mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv",
+            "value": 100000
+        }
+    ],
+    "wifs": [],
+    "feerate": 2,
+    "change": "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"
+}
+`,
+		},
+		{
+			name: "spent output next to the UTXO",
+			args: []string{"utxo", "to-input", "--to", utxoAddr1 + ":10000", "--change", utxoAddr2, "--min-conf", "6", utxoAddr2},
+			want: `{
+    "ins": [
+        {
+            "txid": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+            "vout": 0,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 1000
+        },
+        {
+            "txid": "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+            "vout": 1,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 20000
+        }
+    ],
+    "outs": [
+        {
+            "addr": "mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv",
+            "value": 10000
+        }
+    ],
+    "wifs": [],
+    "feerate": 1,
+    "change": "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"
+}
+`,
+		},
+		{
+			name: "repeated address",
+			args: []string{"utxo", "to-input", "--to", utxoAddr1 + ":10000", "--change", utxoAddr2, "--min-conf", "6", utxoAddr2, utxoAddr2},
+			want: `{
+    "ins": [
+        {
+            "txid": "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+            "vout": 0,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 1000
+        },
+        {
+            "txid": "cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+            "vout": 1,
+            "scriptpubkey": "00143e73b512900677abbff836104829b733de821867",
+            "value": 20000
+        }
+    ],
+    "outs": [
+        {
+            "addr": "mx1UsJZ9aS1z7YrebihuxsTYdUthkcHWTv",
+            "value": 10000
+        }
+    ],
+    "wifs": [],
+    "feerate": 1,
+    "change": "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww"
+}
+`,
+		},
+		{
+			name: "no UTXOs with min-conf",
+			args: []string{"utxo", "to-input", "--to", utxoAddr1 + ":100000", "--change", utxoAddr2, "--min-conf", "12", utxoAddr2},
+			err:  true,
+		},
+		{
+			name: "invalid payee",
+			args: []string{"utxo", "to-input", "--to", utxoAddr1, "--change", utxoAddr2, utxoAddr2},
+			err:  true,
+		},
+		{
+			name: "no payees",
+			args: []string{"utxo", "to-input", "--change", utxoAddr2, utxoAddr2},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, "", append([]string{"--esplora-url", srv.URL}, tt.args...)...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("mybtc %v returned\n%s\nwant\n%s", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newUTXOToInputCmdGenerate fills the WIF in the output of utxo to-input,
+// and checks that the generated transaction passes tx verify even with the address repeated.
+func Test_newUTXOToInputCmdGenerate(t *testing.T) {
+	srv := newUTXOServer(t)
+
+	got, err := executeCmd(t, "", "--esplora-url", srv.URL, "utxo", "to-input",
+		"--to", utxoAddr1+":100000", "--change", utxoAddr2, utxoAddr2, utxoAddr2)
+	if err != nil {
+		t.Fatalf("mybtc utxo to-input failed: %s", err)
+	}
+
+	var input tx.Input
+	if err := json.Unmarshal([]byte(got), &input); err != nil {
+		t.Fatalf("couldn't parse the output: %s", err)
+	}
+
+	input.WIFs = []string{"cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk"}
+	inputFile := filepath.Join(t.TempDir(), "input.json")
+
+	if err := os.WriteFile(inputFile, []byte(marshalInput(t, input)), 0o600); err != nil {
+		t.Fatalf("couldn't write the input: %s", err)
+	}
+
+	rawTx := generateTx(t, input)
+
+	if _, err := executeCmd(t, rawTx, "tx", "verify", "--input", inputFile); err != nil {
+		t.Errorf("mybtc tx verify failed: %s", err)
+	}
+
+	d, err := tx.Decode(rawTx, &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatalf("couldn't decode the transaction: %s", err)
+	}
+
+	// the payee and the change
+	if len(d.Vin) != 3 || len(d.Vout) != 2 {
+		t.Errorf("the transaction has %d inputs and %d outputs, want 3 and 2", len(d.Vin), len(d.Vout))
+	}
+
+	// the spent output next to the UTXO in cccc... isn't spent again
+	for _, in := range d.Vin {
+		if in.TxID == strings.Repeat("c", 64) && *in.Vout != 1 {
+			t.Errorf("the transaction spends %s:%d, which is already spent", in.TxID, *in.Vout)
+		}
+	}
+}
+
+// Test_newUTXOListCmdRetries checks that the calls failed by the Esplora API are retried as --esplora-retries.
+func Test_newUTXOListCmdRetries(t *testing.T) {
+	for _, retries := range []int32{0, 1} {
+		var calls int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(srv.Close)
+
+		if _, err := executeCmd(t, "", "--esplora-url", srv.URL, "--esplora-retries", fmt.Sprint(retries),
+			"--esplora-rate", "0", "utxo", "list", utxoAddr1); err == nil {
+			t.Errorf("mybtc utxo list succeeded with the failing API")
+		}
+
+		if got := atomic.LoadInt32(&calls); got != retries+1 {
+			t.Errorf("mybtc utxo list --esplora-retries %d called the API %d times, want %d", retries, got, retries+1)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
+	"text/tabwriter"
 
+	"github.com/3f2cm/mybtc/bip38"
 	"github.com/3f2cm/mybtc/cli"
 	"github.com/3f2cm/mybtc/wif"
 	"github.com/spf13/cobra"
@@ -22,22 +25,38 @@ generating WIF, parsing the contents, extract its pubkey address, and so on.`,
 
 	// register subcommands
 	wifCmd.AddCommand(newWIFGenerateCmd(env))
-	wifCmd.AddCommand(newWIFAddressCmd())
+	wifCmd.AddCommand(newWIFAddressCmd(env))
+	wifCmd.AddCommand(newWIFInspectCmd(env))
+	wifCmd.AddCommand(newWIFEncryptCmd(env))
+	wifCmd.AddCommand(newWIFDecryptCmd(env))
+	wifCmd.AddCommand(newWIFIntermediateCmd(env))
 
 	return wifCmd
 }
 
 func newWIFGenerateCmd(env *cli.Env) *cobra.Command {
+	var (
+		compressed bool
+		label      string
+	)
+
 	generateCmd := &cobra.Command{
 		Use:   "generate",
 		Short: "generates a new WIF",
-		Long:  `generates a new WIF by generating a new private key`,
+		Long: `generates a new WIF by generating a new private key
+
+The WIF is for the compressed public key by default, and for the uncompressed one with --compressed=false.
+With --save, the WIF is saved in the keystore with the label instead of being printed.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			w, err := wif.New(env.Rand)
+			w, err := wif.New(env.Rand, env.Net, compressed)
 			if err != nil {
 				return fmt.Errorf("couldn't generate a WIF: %w", err)
 			}
 
+			if label != "" {
+				return saveWIF(env, label, w)
+			}
+
 			cmd.Println(w)
 
 			return nil
@@ -45,42 +64,106 @@ func newWIFGenerateCmd(env *cli.Env) *cobra.Command {
 		SilenceUsage: true,
 	}
 
+	generateCmd.Flags().BoolVar(&compressed, "compressed", true, "generate a WIF for the compressed public key")
+	generateCmd.Flags().StringVar(&label, "save", "", "label to save the WIF in the keystore with")
+
 	return generateCmd
 }
 
-func newWIFAddressCmd() *cobra.Command {
+// saveWIF saves the WIF in the keystore with the label.
+func saveWIF(env *cli.Env, label, w string) error {
+	k, err := unlockKeystore(env)
+	if err != nil {
+		return err
+	}
+
+	if err := k.Add(label, w, env.Net.Name); err != nil {
+		return fmt.Errorf("couldn't add the WIF to the keystore: %w", err)
+	}
+
+	if err := k.Save(); err != nil {
+		return fmt.Errorf("couldn't save the keystore: %w", err)
+	}
+
+	return nil
+}
+
+func newWIFAddressCmd(env *cli.Env) *cobra.Command {
+	var addrType string
+
 	generateCmd := &cobra.Command{
 		Use:   "address",
-		Short: "converts given WIFs to TestNet3 Address",
-		Long:  `receives WIFs from STDIN and converts them to addresses`,
+		Short: "converts given WIFs to addresses",
+		Long: `receives WIFs from STDIN and converts them to addresses
+
+The address type is P2PKH by default, and P2SH-P2WPKH, P2WPKH or P2TR (BIP86) with
+--type p2sh-p2wpkh, p2wpkh or p2tr.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return eachLine(cmd.InOrStdin(), func(i uint64, s string) error {
+				a, err := wif.ExtractAddr(s, wif.AddrType(addrType), env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't extract an address from line %d: %w", i, err)
+				}
+
+				cmd.Println(a)
+
+				return nil
+			})
+		},
+		SilenceUsage: true,
+	}
+
+	generateCmd.Flags().StringVar(&addrType, "type", string(wif.AddrTypeP2PKH), "address type: p2pkh, p2sh-p2wpkh, p2wpkh or p2tr")
+
+	return generateCmd
+}
+
+func newWIFInspectCmd(env *cli.Env) *cobra.Command {
+	var asJSON bool
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "describes given WIFs",
+		Long: `receives WIFs from STDIN and prints the network, the compression flag, the private key,
+the public keys in both encodings, the Hash160 of the public key and the addresses of every type.
+
+The Hash160 is of the public key encoded as the compression flag of the WIF.
+SegWit v0 addresses are not shown for uncompressed public keys.
+The WIFs are described as JSON with --json.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			buf := bufio.NewReader(cmd.InOrStdin())
-
-			i := uint64(0)
-			eof := false
-			for {
-				i++
-
-				s, err := buf.ReadString('\n')
-				if err == io.EOF {
-					eof = true
-				} else if err != nil {
-					return fmt.Errorf("read error happened: %w", err)
+			infos := []*wif.Info{}
+
+			err := eachLine(cmd.InOrStdin(), func(i uint64, s string) error {
+				info, err := wif.Inspect(s, env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't inspect the WIF at line %d: %w", i, err)
 				}
 
-				s = strings.TrimSpace(s)
-				if len(s) > 0 {
-					a, err := wif.ExtractAddr(s)
-					if err != nil {
-						return fmt.Errorf("couldn't extract an address from line %d: %w", i, err)
-					}
+				infos = append(infos, info)
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
 
-					cmd.Println(a)
+			if asJSON {
+				j, err := json.MarshalIndent(infos, "", "    ")
+				if err != nil {
+					return fmt.Errorf("couldn't serialize the descriptions: %w", err)
 				}
 
-				if eof {
-					break
+				cmd.Println(string(j))
+
+				return nil
+			}
+
+			for i, info := range infos {
+				if i > 0 {
+					cmd.Println()
 				}
+
+				printWIFInfo(cmd.OutOrStdout(), info)
 			}
 
 			return nil
@@ -88,5 +171,201 @@ func newWIFAddressCmd() *cobra.Command {
 		SilenceUsage: true,
 	}
 
-	return generateCmd
+	inspectCmd.Flags().BoolVar(&asJSON, "json", false, "print the descriptions as JSON")
+
+	return inspectCmd
+}
+
+// printWIFInfo prints the description of a WIF with aligned labels.
+func printWIFInfo(out io.Writer, info *wif.Info) {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(w, "network:\t%s\n", info.Network)
+	fmt.Fprintf(w, "compressed:\t%t\n", info.Compressed)
+	fmt.Fprintf(w, "private key:\t%s\n", info.PrivKey)
+	fmt.Fprintf(w, "compressed public key:\t%s\n", info.CompressedPubKey)
+	fmt.Fprintf(w, "uncompressed public key:\t%s\n", info.UncompressedPubKey)
+	fmt.Fprintf(w, "hash160:\t%s\n", info.Hash160)
+	fmt.Fprintf(w, "p2pkh:\t%s\n", info.P2PKHAddr)
+
+	if info.Compressed {
+		fmt.Fprintf(w, "p2wpkh:\t%s\n", info.P2WPKHAddr)
+		fmt.Fprintf(w, "p2sh-p2wpkh:\t%s\n", info.P2SHP2WPKHAddr)
+	}
+
+	fmt.Fprintf(w, "p2tr:\t%s\n", info.P2TRAddr)
+
+	//nolint:errcheck // the writer is a buffer or STDOUT
+	w.Flush()
+}
+
+// eachLine calls f with each non-empty line read from r and its line number.
+func eachLine(r io.Reader, f func(i uint64, s string) error) error {
+	buf := bufio.NewReader(r)
+
+	i := uint64(0)
+	eof := false
+	for {
+		i++
+
+		s, err := buf.ReadString('\n')
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return fmt.Errorf("read error happened: %w", err)
+		}
+
+		s = strings.TrimSpace(s)
+		if len(s) > 0 {
+			if err := f(i, s); err != nil {
+				return err
+			}
+		}
+
+		if eof {
+			return nil
+		}
+	}
+}
+
+// readLines returns the non-empty lines read from r by eachLine.
+func readLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+
+	err := eachLine(r, func(_ uint64, s string) error {
+		lines = append(lines, s)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+func newWIFEncryptCmd(env *cli.Env) *cobra.Command {
+	var (
+		intermediate string
+		compressed   bool
+	)
+
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "encrypts WIFs with BIP38",
+		Long: `receives WIFs from STDIN and encrypts them with the passphrase along BIP38
+
+The passphrase is read from $` + cli.PassphraseEnv + ` or prompted.
+
+With --intermediate, generates a new encrypted key and its P2PKH address from the intermediate code
+given by the owner of the passphrase (EC multiplication) instead. STDIN and the passphrase are not used then.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if intermediate != "" {
+				key, addr, err := bip38.NewEncryptedKey(env.Rand, intermediate, compressed, env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't generate an encrypted key: %w", err)
+				}
+
+				cmd.Printf("%s\t%s\n", key, addr)
+
+				return nil
+			}
+
+			// the passphrase is asked at the first key, and not without keys
+			return eachLine(cmd.InOrStdin(), func(i uint64, s string) error {
+				passphrase, err := env.Passphrase()
+				if err != nil {
+					return err
+				}
+
+				w, err := wif.Decode(s, env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't decode the WIF at line %d: %w", i, err)
+				}
+
+				e, err := bip38.Encrypt(w, passphrase, env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't encrypt the WIF at line %d: %w", i, err)
+				}
+
+				cmd.Println(e)
+
+				return nil
+			})
+		},
+		SilenceUsage: true,
+	}
+
+	encryptCmd.Flags().StringVar(&intermediate, "intermediate", "", "intermediate code to generate a new key with EC multiplication")
+	encryptCmd.Flags().BoolVar(&compressed, "compressed", true, "generate a key for the compressed public key with --intermediate")
+
+	return encryptCmd
+}
+
+func newWIFDecryptCmd(env *cli.Env) *cobra.Command {
+	decryptCmd := &cobra.Command{
+		Use:   "decrypt",
+		Short: "decrypts BIP38 encrypted keys",
+		Long: `receives BIP38 encrypted keys from STDIN and decrypts them with the passphrase into WIFs
+
+Keys encrypted both with and without EC multiplication are accepted.
+The passphrase is read from $` + cli.PassphraseEnv + ` or prompted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the passphrase is asked at the first key, and not without keys
+			return eachLine(cmd.InOrStdin(), func(i uint64, s string) error {
+				passphrase, err := env.Passphrase()
+				if err != nil {
+					return err
+				}
+
+				w, err := bip38.Decrypt(s, passphrase, env.Net)
+				if err != nil {
+					return fmt.Errorf("couldn't decrypt the key at line %d: %w", i, err)
+				}
+
+				cmd.Println(w.String())
+
+				return nil
+			})
+		},
+		SilenceUsage: true,
+	}
+
+	return decryptCmd
+}
+
+func newWIFIntermediateCmd(env *cli.Env) *cobra.Command {
+	var lot, sequence uint32
+
+	intermediateCmd := &cobra.Command{
+		Use:   "intermediate",
+		Short: "generates a BIP38 intermediate code",
+		Long: `generates an intermediate code from the passphrase along BIP38
+
+Give the code to someone else to let them generate keys encrypted with the passphrase
+by "wif encrypt --intermediate" without knowing it.
+The passphrase is read from $` + cli.PassphraseEnv + ` or prompted.
+The lot and sequence numbers are embedded in the code when --lot is given.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passphrase, err := env.Passphrase()
+			if err != nil {
+				return err
+			}
+
+			code, err := bip38.NewIntermediate(env.Rand, passphrase, cmd.Flags().Changed("lot"), lot, sequence)
+			if err != nil {
+				return fmt.Errorf("couldn't generate an intermediate code: %w", err)
+			}
+
+			cmd.Println(code)
+
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	intermediateCmd.Flags().Uint32Var(&lot, "lot", 0, fmt.Sprintf("lot number (0-%d)", bip38.MaxLot))
+	intermediateCmd.Flags().Uint32Var(&sequence, "sequence", 0, fmt.Sprintf("sequence number (0-%d) used with --lot", bip38.MaxSequence))
+
+	return intermediateCmd
 }
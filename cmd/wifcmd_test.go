@@ -26,12 +26,24 @@ func Test_newGenerateCmd(t *testing.T) {
 			name: "seed = 1",
 			args: []string{"wif", "generate"},
 			seed: 1,
-			wif:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			wif:  "cNKwwBtVWr3nE8t3bL96iHUcja89Qrk8QmsEC1fm7fJpnrAtGR3z\n",
 		},
 		{
 			name: "seed = 37",
 			args: []string{"wif", "generate"},
 			seed: 37,
+			wif:  "cQnit6sBpzA2CrHCw8HoShnH31qVB6vSJefTVpsDsPGYqkKBv3UF\n",
+		},
+		{
+			name: "seed = 1, uncompressed",
+			args: []string{"wif", "generate", "--compressed=false"},
+			seed: 1,
+			wif:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+		},
+		{
+			name: "seed = 37, uncompressed",
+			args: []string{"wif", "generate", "--compressed=false"},
+			seed: 37,
 			wif:  "92K4bgqyq2d2dfoifzqfcjKR2N2vWUd86MmWZp6VHrTBPQiHqUP\n",
 		},
 	}
@@ -180,6 +192,86 @@ func Test_newAddressCmd(t *testing.T) {
 			stderr: "Error: couldn't extract an address from line 2",
 			isErr:  true,
 		},
+		{
+			name:   "compressed",
+			args:   []string{"wif", "address"},
+			stdin:  "cNKwwBtVWr3nE8t3bL96iHUcja89Qrk8QmsEC1fm7fJpnrAtGR3z\ncQ6MpqgwL6Xv6pz1v5Xzeewd1NkjYkXazWJTasVZ4LxgnJaBPAEY\n",
+			stdout: "mrNzPvKPhZk4kZvMmKBg3xXuJiF29D21Yt\nmqQXArFGskfAbYq6mWdGL8oJT4292dB89g\n",
+			stderr: "",
+			isErr:  false,
+		},
+		{
+			name:   "P2SH-P2WPKH",
+			args:   []string{"wif", "address", "--type", "p2sh-p2wpkh"},
+			stdin:  "cQ6MpqgwL6Xv6pz1v5Xzeewd1NkjYkXazWJTasVZ4LxgnJaBPAEY\ncVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+			stdout: "2N52cqKfvLrip3XjxKSna8KDUH76yK772FM\n2N74kddRoV8rW74gyQ83ZLhUnbBQh2oKciG\n",
+			stderr: "",
+			isErr:  false,
+		},
+		{
+			name:   "P2WPKH",
+			args:   []string{"wif", "address", "--type", "p2wpkh"},
+			stdin:  "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+			stdout: "tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww\n",
+			stderr: "",
+			isErr:  false,
+		},
+		{
+			name:   "P2TR",
+			args:   []string{"wif", "address", "--type", "p2tr"},
+			stdin:  "cVptxTqUZCh9KrByXhvXn8dEGDpTLaXeo9HY435DS5fpEn6if3jg\n",
+			stdout: "tb1pu3g5yagczsrpuux7r6parh0wwfrxhj39yta5khuc0njft4l28nmquz6kg7\n",
+			stderr: "",
+			isErr:  false,
+		},
+		{
+			name:   "P2SH-P2WPKH with an uncompressed WIF",
+			args:   []string{"wif", "address", "--type", "p2sh-p2wpkh"},
+			stdin:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			stdout: "",
+			stderr: "Error: couldn't extract an address from line 1",
+			isErr:  true,
+		},
+		{
+			name:   "mainnet",
+			args:   []string{"wif", "address", "--network", "mainnet"},
+			stdin:  "5Hz5s8gLjKS3HF97AVrA99c1vzxg92HBj5hGstFZK2HGkqKGz1L\n",
+			stdout: "1KawqMWX3bmSdhTKV2AntwHgemYSj6G7VJ\n",
+			stderr: "",
+			isErr:  false,
+		},
+		{
+			name:   "regtest shares the prefixes with testnet3",
+			args:   []string{"wif", "address", "--network", "regtest"},
+			stdin:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			stdout: "mz6u8QbVrdChQovwCb9AirW1Wm99fUJ7ko\n",
+			stderr: "",
+			isErr:  false,
+		},
+		{
+			name:   "WIF for another network",
+			args:   []string{"wif", "address", "--network", "mainnet"},
+			stdin:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			stdout: "",
+			stderr: "Error: couldn't extract an address from line 1",
+			isErr:  true,
+		},
+		{
+			name:   "unknown network",
+			args:   []string{"wif", "address", "--network", "litecoin"},
+			stdin:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			stdout: "",
+			stderr: "Error: unknown network",
+			isErr:  true,
+		},
+		{
+			name:   "unknown type",
+			args:   []string{"wif", "address", "--type", "p2pk"},
+			stdin:  "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			stdout: "",
+			stderr: "Error: couldn't extract an address from line 1",
+			isErr:  true,
+		},
 	}
 	for _, tt := range tests {
 		stdin := strings.NewReader(tt.stdin)
@@ -207,3 +299,292 @@ func Test_newAddressCmd(t *testing.T) {
 		})
 	}
 }
+
+func Test_newWIFEncryptDecryptCmd(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		passphrase string
+		stdin      string
+		want       string
+		err        string
+	}{
+		{
+			name:       "encrypt an uncompressed key",
+			args:       []string{"--network", "mainnet", "wif", "encrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR\n",
+			want:       "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg\n",
+		},
+		{
+			name:       "encrypt a compressed key",
+			args:       []string{"--network", "mainnet", "wif", "encrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "L44B5gGEpqEDRS9vVPz7QT35jcBG2r3CZwSwQ4fCewXAhAhqGVpP\n",
+			want:       "6PYNKZ1EAgYgmQfmNVamxyXVWHzK5s6DGhwP4J5o44cvXdoY7sRzhtpUeo\n",
+		},
+		{
+			name:       "encrypt a testnet key",
+			args:       []string{"wif", "encrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+			want:       "6PYWRqmVjc6EHAn9ha1fXjH8wNBDZzdaLKfXjF8NHRCDRdFkqzeZcRWTaX\n",
+		},
+		{
+			name:       "decrypt a non-EC-multiplied key",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg\n",
+			want:       "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR\n",
+		},
+		{
+			name:       "decrypt an EC-multiplied key",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "6PfQu77ygVyJLZjfvMLyhLMQbYnu5uguoJJ4kMCLqWwPEdfpwANVS76gTX\n",
+			want:       "5K4caxezwjGCGfnoPTZ8tMcJBLB7Jvyjv4xxeacadhq8nLisLR2\n",
+		},
+		{
+			name:       "decrypt an EC-multiplied key with lot and sequence numbers",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "MOLON LABE",
+			stdin:      "6PgNBNNzDkKdhkT6uJntUXwwzQV8Rr2tZcbkDcuC9DZRsS6AtHts4Ypo1j\n",
+			want:       "5JLdxTtcTHcfYcmJsNVy1v2PMDx432JPoYcBTVVRHpPaxUrdtf8\n",
+		},
+		{
+			name:       "wrong passphrase",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "TestingOneTwoThre",
+			stdin:      "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg\n",
+			err:        "line 1",
+		},
+		{
+			name:       "not encrypted",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR\n",
+			err:        "line 1",
+		},
+		{
+			name:       "not encrypted after blank lines",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg\n\n\n5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR\n",
+			want:       "5KN7MzqK5wt2TP1fQCYyHBtDrXdJuXbUzm4A9rKAteGu3Qi5CVR\n",
+			err:        "line 4",
+		},
+		{
+			name:       "not a WIF after blank lines",
+			args:       []string{"--network", "mainnet", "wif", "encrypt"},
+			passphrase: "TestingOneTwoThree",
+			stdin:      "\n\n6PRVWUbkzzsbcVac2qwfssoUJAN1Xhrg6bNk8J7Nzm5H7kxEbn2Nh2ZoGg\n",
+			err:        "line 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{cli.PassphraseEnv: tt.passphrase}
+
+			got, err := executeCmdWithEnv(t, vars, tt.stdin, tt.args...)
+			if (err != nil) != (tt.err != "") {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("mybtc %s returned %q, want the error at %s", strings.Join(tt.args, " "), err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("mybtc %s returned %s, want %s", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newWIFEncryptDecryptCmdUnicode checks the test vector of BIP38 with a passphrase normalized to NFC.
+// The passphrase is prompted because it has a null character, which can't be in an environment variable.
+func Test_newWIFEncryptDecryptCmdUnicode(t *testing.T) {
+	const (
+		wif       = "5Jajm8eQ22H3pGWLEVCXyvND8dQZhiQhoLJNKjYXk9roUFTMSZ4"
+		encrypted = "6PRW5o9FLp4gJDDVqJQKJFTpMvdsSGJxMYHtHaQBF3ooa8mwD69bapcDQn"
+	)
+
+	tests := []struct {
+		name       string
+		args       []string
+		passphrase string
+		stdin      string
+		want       string
+	}{
+		{
+			name:       "encrypt",
+			args:       []string{"--network", "mainnet", "wif", "encrypt"},
+			passphrase: "\u03D2\u0301\u0000\U00010400\U0001F4A9",
+			stdin:      wif + "\n",
+			want:       encrypted + "\n",
+		},
+		{
+			name:       "decrypt",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "\u03D2\u0301\u0000\U00010400\U0001F4A9",
+			stdin:      encrypted + "\n",
+			want:       wif + "\n",
+		},
+		{
+			name:       "decrypt with the passphrase composed beforehand",
+			args:       []string{"--network", "mainnet", "wif", "decrypt"},
+			passphrase: "\u03D3\u0000\U00010400\U0001F4A9",
+			stdin:      encrypted + "\n",
+			want:       wif + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			rootCmd := cmd.NewRootCmd(&cli.Env{
+				Stdin:     strings.NewReader(tt.stdin),
+				Stdout:    stdout,
+				Stderr:    &bytes.Buffer{},
+				Prompt:    func(string) (string, error) { return tt.passphrase, nil },
+				LookupEnv: lookupEnv(nil),
+			}, tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+
+			if got := stdout.String(); got != tt.want {
+				t.Errorf("mybtc %s returned %s, want %s", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_newWIFEncryptCmdIntermediate generates keys from intermediate codes without the passphrase,
+// and checks that they are decrypted with the passphrase into the WIFs of the generated addresses.
+func Test_newWIFEncryptCmdIntermediate(t *testing.T) {
+	tests := []struct {
+		name             string
+		intermediateArgs []string
+		encryptArgs      []string
+	}{
+		{
+			name:             "compressed",
+			intermediateArgs: []string{"wif", "intermediate"},
+			encryptArgs:      []string{"wif", "encrypt"},
+		},
+		{
+			name:             "uncompressed with lot and sequence numbers",
+			intermediateArgs: []string{"wif", "intermediate", "--lot", "263183", "--sequence", "1"},
+			encryptArgs:      []string{"wif", "encrypt", "--compressed=false"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//nolint:gosec // It's for test, and we need specified seeds
+			r := rand.New(rand.NewSource(1))
+
+			execute := func(stdin string, args ...string) string {
+				stdout := &bytes.Buffer{}
+				rootCmd := cmd.NewRootCmd(&cli.Env{
+					Stdin:     strings.NewReader(stdin),
+					Stdout:    stdout,
+					Stderr:    &bytes.Buffer{},
+					Rand:      r,
+					LookupEnv: lookupEnv(map[string]string{cli.PassphraseEnv: "MOLON LABE"}),
+				}, args)
+
+				if err := rootCmd.Execute(); err != nil {
+					t.Fatalf("mybtc %s failed: %s", strings.Join(args, " "), err)
+				}
+
+				return strings.TrimSpace(stdout.String())
+			}
+
+			code := execute("", tt.intermediateArgs...)
+			if !strings.HasPrefix(code, "passphrase") {
+				t.Fatalf("the intermediate code %s doesn't start with passphrase", code)
+			}
+
+			keyAddr := strings.Split(execute("", append(tt.encryptArgs, "--intermediate", code)...), "\t")
+			if len(keyAddr) != 2 || !strings.HasPrefix(keyAddr[0], "6P") {
+				t.Fatalf("unexpected encrypted key and address: %v", keyAddr)
+			}
+
+			w := execute(keyAddr[0], "wif", "decrypt")
+			if addr := execute(w, "wif", "address"); addr != keyAddr[1] {
+				t.Errorf("the decrypted WIF %s is for %s, want %s", w, addr, keyAddr[1])
+			}
+		})
+	}
+}
+
+func Test_newWIFInspectCmd(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  string
+		err   bool
+	}{
+		{
+			name: "compressed and uncompressed",
+			args: []string{"wif", "inspect"},
+			stdin: "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n" +
+				"91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			want: `network:                 testnet3
+compressed:              true
+private key:             f90055227bb5d044250e9a676d5f17d082818f63d1debd9a55a6c9183e6a10f7
+compressed public key:   03be3a9face9569207eec4157757694ba93c031354a201b43a6e1408df4dc0a1f1
+uncompressed public key: 04be3a9face9569207eec4157757694ba93c031354a201b43a6e1408df4dc0a1f150ed80b9a35a38e6bdf69f2cfc71d9ecefe24b3d818402c4c0d8f0b9031cca4d
+hash160:                 3e73b512900677abbff836104829b733de821867
+p2pkh:                   mmDAoS3ikRwdzBsgthomvfHN8ju7iAzRwF
+p2wpkh:                  tb1q8eem2y5sqem6h0lcxcgys2dhx00gyxr80nqxww
+p2sh-p2wpkh:             2N74kddRoV8rW74gyQ83ZLhUnbBQh2oKciG
+p2tr:                    tb1p9pypeen8kylunf0ds249ae3p9xlp4t9skv7tq83vmuxa9xjp0nuql7gv3u
+
+network:                 testnet3
+compressed:              false
+private key:             163f5f0f9a621d72fedd85ffca3d08d131ab4e812181e0d30ffd1c885d20aac7
+compressed public key:   038d505c351f4837cec72bce6f4254f5e4bc3f2c9a4816841db64319eee8b714ef
+uncompressed public key: 048d505c351f4837cec72bce6f4254f5e4bc3f2c9a4816841db64319eee8b714ef9173fbf66d039b782624713791840846b2788d4b65a425adeba85a4b57efe0cd
+hash160:                 cbddc381dd86b66fce93b76ed3bd60b756c2bfb0
+p2pkh:                   mz6u8QbVrdChQovwCb9AirW1Wm99fUJ7ko
+p2tr:                    tb1pu8ellhvkg260d46smusyhhvrhgjzgq45tesvrjgq5wgg6ushew7q09cgg6
+`,
+		},
+		{
+			name:  "JSON",
+			args:  []string{"wif", "inspect", "--json"},
+			stdin: "91kiSsVtKYWBFJePnqk51k9yafKPJBpP52ZDxWc4em2KXtF82B3\n",
+			want: `[
+    {
+        "network": "testnet3",
+        "compressed": false,
+        "privkey": "163f5f0f9a621d72fedd85ffca3d08d131ab4e812181e0d30ffd1c885d20aac7",
+        "compressed_pubkey": "038d505c351f4837cec72bce6f4254f5e4bc3f2c9a4816841db64319eee8b714ef",
+        "uncompressed_pubkey": "048d505c351f4837cec72bce6f4254f5e4bc3f2c9a4816841db64319eee8b714ef9173fbf66d039b782624713791840846b2788d4b65a425adeba85a4b57efe0cd",
+        "hash160": "cbddc381dd86b66fce93b76ed3bd60b756c2bfb0",
+        "p2pkh": "mz6u8QbVrdChQovwCb9AirW1Wm99fUJ7ko",
+        "p2tr": "tb1pu8ellhvkg260d46smusyhhvrhgjzgq45tesvrjgq5wgg6ushew7q09cgg6"
+    }
+]
+`,
+		},
+		{
+			name:  "wrong network",
+			args:  []string{"--network", "mainnet", "wif", "inspect"},
+			stdin: "cVvj9zZ39AU3SMaaccvjywLybmHBntYhxCFteA78KWnhcAYZLJDk\n",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeCmd(t, tt.stdin, tt.args...)
+			if (err != nil) != tt.err {
+				t.Fatalf("command failed unexpectedly: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("mybtc %s returned %s, want %s", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Package coinselect chooses coins (UTXOs) to spend for payments
+
+- Select chooses coins with branch-and-bound, or falls back to a selection with a change output
+*/
+package coinselect
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// bnbMaxTries limits the number of steps of branch-and-bound search.
+const bnbMaxTries = 100000
+
+// ErrInsufficientFunds is returned when the coins can't pay the target and the fee.
+var ErrInsufficientFunds = errors.New("the coins are insufficient for the payments and the fee")
+
+// Coin expresses a candidate to be spent.
+type Coin struct {
+	Value int64
+	// InputVSize is the estimated virtual size of the input spending the coin.
+	InputVSize int
+}
+
+// Params expresses the conditions of the selection.
+type Params struct {
+	// Target is the total value of the payments.
+	Target int64
+	// FeeRate is the fee rate in sat/vB.
+	FeeRate float64
+	// BaseVSize is the virtual size of the transaction without inputs and the change output.
+	BaseVSize int
+	// ChangeVSize is the virtual size of the change output.
+	ChangeVSize int
+	// ChangeSpendVSize is the virtual size of the input spending the change output in the future.
+	ChangeSpendVSize int
+}
+
+// Result expresses the selected coins.
+type Result struct {
+	// Indices are the indices of the selected coins in the given coins.
+	Indices []int
+	// Change is whether the transaction needs a change output.
+	Change bool
+}
+
+// Select chooses coins to pay the target and the fee at the fee rate.
+// It tries to find coins without a change output by branch-and-bound first,
+// and then falls back to the smallest sufficient coin or the largest coins first with a change output.
+func Select(coins []Coin, params Params) (*Result, error) {
+	candidates := effectiveCoins(coins, params.FeeRate)
+
+	target := params.Target + fee(params.FeeRate, params.BaseVSize)
+	costOfChange := fee(params.FeeRate, params.ChangeVSize+params.ChangeSpendVSize)
+
+	if indices := selectBnB(candidates, target, costOfChange); indices != nil {
+		return &Result{Indices: indices, Change: false}, nil
+	}
+
+	// The change output is paid by the selected coins
+	target += fee(params.FeeRate, params.ChangeVSize)
+
+	if indices := selectSmallestSufficient(candidates, target); indices != nil {
+		return &Result{Indices: indices, Change: true}, nil
+	}
+
+	if indices := selectLargestFirst(candidates, target); indices != nil {
+		return &Result{Indices: indices, Change: true}, nil
+	}
+
+	return nil, ErrInsufficientFunds
+}
+
+// effectiveCoin is a coin with its value after paying the fee of the input spending it.
+type effectiveCoin struct {
+	index int
+	value int64
+}
+
+// effectiveCoins returns the coins worth spending at the fee rate in descending order of their effective values.
+func effectiveCoins(coins []Coin, feeRate float64) []effectiveCoin {
+	ecs := []effectiveCoin{}
+
+	for i, c := range coins {
+		v := c.Value - fee(feeRate, c.InputVSize)
+		if v > 0 {
+			ecs = append(ecs, effectiveCoin{index: i, value: v})
+		}
+	}
+
+	sort.SliceStable(ecs, func(i, j int) bool {
+		return ecs[i].value > ecs[j].value
+	})
+
+	return ecs
+}
+
+// selectBnB searches coins whose total effective value is in [target, target+costOfChange]
+// with the least excess by depth-first search, which makes a change output unnecessary.
+func selectBnB(coins []effectiveCoin, target, costOfChange int64) []int {
+	// remaining[i] is the total of coins[i:], which bounds the search
+	remaining := make([]int64, len(coins)+1)
+	for i := len(coins) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + coins[i].value
+	}
+
+	var (
+		best       []bool
+		bestExcess int64 = math.MaxInt64
+		selected         = make([]bool, len(coins))
+		tries            = 0
+	)
+
+	var search func(depth int, total int64)
+	search = func(depth int, total int64) {
+		tries++
+		if tries > bnbMaxTries {
+			return
+		}
+
+		// too much, or impossible to reach the target
+		if total > target+costOfChange || total+remaining[depth] < target {
+			return
+		}
+
+		if total >= target {
+			if excess := total - target; excess < bestExcess {
+				bestExcess = excess
+				best = append([]bool{}, selected...)
+			}
+
+			return
+		}
+
+		if depth == len(coins) {
+			return
+		}
+
+		// including a coin after excluding one with the same value results in the same search as before
+		if depth == 0 || selected[depth-1] || coins[depth-1].value != coins[depth].value {
+			selected[depth] = true
+			search(depth+1, total+coins[depth].value)
+			selected[depth] = false
+		}
+
+		search(depth+1, total)
+	}
+
+	search(0, 0)
+
+	if best == nil {
+		return nil
+	}
+
+	indices := []int{}
+	for i, s := range best {
+		if s {
+			indices = append(indices, coins[i].index)
+		}
+	}
+
+	return indices
+}
+
+// selectSmallestSufficient chooses the single coin with the smallest effective value covering the target.
+func selectSmallestSufficient(coins []effectiveCoin, target int64) []int {
+	for i := len(coins) - 1; i >= 0; i-- {
+		if coins[i].value >= target {
+			return []int{coins[i].index}
+		}
+	}
+
+	return nil
+}
+
+// selectLargestFirst chooses coins in descending order of their effective values until they cover the target.
+func selectLargestFirst(coins []effectiveCoin, target int64) []int {
+	indices := []int{}
+	total := int64(0)
+
+	for _, c := range coins {
+		indices = append(indices, c.index)
+		total += c.value
+
+		if total >= target {
+			return indices
+		}
+	}
+
+	return nil
+}
+
+// fee calculates the fee in satoshi for the vsize at the fee rate in sat/vB.
+func fee(feeRate float64, vsize int) int64 {
+	return int64(math.Ceil(feeRate * float64(vsize)))
+}
@@ -0,0 +1,106 @@
+package coinselect_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/3f2cm/mybtc/coinselect"
+)
+
+// coins makes coins spent by inputs of 68 vB, so their effective values at 1 sat/vB are the values minus 68.
+func coins(values ...int64) []coinselect.Coin {
+	cs := []coinselect.Coin{}
+	for _, v := range values {
+		cs = append(cs, coinselect.Coin{Value: v, InputVSize: 68})
+	}
+
+	return cs
+}
+
+func TestSelect(t *testing.T) {
+	// the fee is 10 without inputs and the change, and the cost of the change is 31 + 68 = 99 at 1 sat/vB
+	params := func(target int64) coinselect.Params {
+		return coinselect.Params{Target: target, FeeRate: 1, BaseVSize: 10, ChangeVSize: 31, ChangeSpendVSize: 68}
+	}
+
+	tests := []struct {
+		name   string
+		coins  []coinselect.Coin
+		params coinselect.Params
+		want   *coinselect.Result
+		err    error
+	}{
+		{
+			name:   "exact match by branch-and-bound",
+			coins:  coins(100068, 50068, 30068),
+			params: params(79990),
+			want:   &coinselect.Result{Indices: []int{1, 2}, Change: false},
+		},
+		{
+			name:   "no change with the least excess",
+			coins:  coins(100068, 20118, 20068, 10068),
+			params: params(19990),
+			want:   &coinselect.Result{Indices: []int{2}, Change: false},
+		},
+		{
+			name:   "dust change left to the fee",
+			coins:  coins(20068),
+			params: params(19891),
+			want:   &coinselect.Result{Indices: []int{0}, Change: false},
+		},
+		{
+			name:   "change worth more than its cost",
+			coins:  coins(20068),
+			params: params(19890),
+			want:   &coinselect.Result{Indices: []int{0}, Change: true},
+		},
+		{
+			name:   "fallback to the smallest sufficient coin",
+			coins:  coins(100068, 50068, 30068, 200068),
+			params: params(59990),
+			want:   &coinselect.Result{Indices: []int{0}, Change: true},
+		},
+		{
+			name:   "fallback to the largest coins first",
+			coins:  coins(30068, 40068, 20068),
+			params: params(75990),
+			want:   &coinselect.Result{Indices: []int{1, 0, 2}, Change: true},
+		},
+		{
+			name:   "dust coins not worth spending",
+			coins:  coins(50, 30068, 68),
+			params: params(29990),
+			want:   &coinselect.Result{Indices: []int{1}, Change: false},
+		},
+		{
+			name:   "insufficient funds",
+			coins:  coins(100068, 50068, 30068),
+			params: params(180000),
+			err:    coinselect.ErrInsufficientFunds,
+		},
+		{
+			name:   "insufficient funds with only dust coins",
+			coins:  coins(50, 68),
+			params: params(1),
+			err:    coinselect.ErrInsufficientFunds,
+		},
+		{
+			name:   "no coins",
+			params: params(1000),
+			err:    coinselect.ErrInsufficientFunds,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := coinselect.Select(tt.coins, tt.params)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Select returned the error %v, want %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select returned %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Package hd handles BIP32 hierarchical deterministic keys
+
+- NewMaster generates a new master extended private key
+- Export exports the extended key of an account along BIP44/49/84/86
+- Derive derives WIFs and addresses of an account along BIP44/49/84/86
+*/
+package hd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/3f2cm/mybtc/wif"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Purpose expresses the purpose field of derivation paths, which decides the address type.
+type Purpose uint32
+
+const (
+	// PurposeBIP44 derives P2PKH addresses.
+	PurposeBIP44 Purpose = 44
+	// PurposeBIP49 derives P2SH-P2WPKH addresses.
+	PurposeBIP49 Purpose = 49
+	// PurposeBIP84 derives P2WPKH addresses.
+	PurposeBIP84 Purpose = 84
+	// PurposeBIP86 derives P2TR addresses.
+	PurposeBIP86 Purpose = 86
+)
+
+// SeedLen is the length of the seed read to generate a master key.
+const SeedLen = hdkeychain.RecommendedSeedLen
+
+// Version bytes of extended keys for BIP49 and BIP84 (SLIP-132).
+// BIP44 and BIP86 use the ones of the network (xpub and tpub).
+var (
+	mainNetBIP49PubID  = []byte{0x04, 0x9d, 0x7c, 0xb2} // ypub
+	mainNetBIP49PrivID = []byte{0x04, 0x9d, 0x78, 0x78} // yprv
+	mainNetBIP84PubID  = []byte{0x04, 0xb2, 0x47, 0x46} // zpub
+	mainNetBIP84PrivID = []byte{0x04, 0xb2, 0x43, 0x0c} // zprv
+	testNetBIP49PubID  = []byte{0x04, 0x4a, 0x52, 0x62} // upub
+	testNetBIP49PrivID = []byte{0x04, 0x4a, 0x4e, 0x28} // uprv
+	testNetBIP84PubID  = []byte{0x04, 0x5f, 0x1c, 0xf6} // vpub
+	testNetBIP84PrivID = []byte{0x04, 0x5f, 0x18, 0xbc} // vprv
+)
+
+var (
+	errNotMaster      = errors.New("the key is not a master extended private key")
+	errWrongNetwork   = errors.New("the extended key is not for the network")
+	errUnknownPurpose = errors.New("unknown purpose: 44, 49, 84 or 86")
+	errIndexRange     = errors.New("the indices must be below 2147483648 (non-hardened)")
+	errAccountRange   = errors.New("the account must be below 2147483648")
+)
+
+// Key expresses a derived key with its path and address.
+type Key struct {
+	Path string `json:"path"`
+	WIF  string `json:"wif"`
+	Addr string `json:"address"`
+}
+
+// NewMaster generates a new master extended private key for the network from the seed read from r.
+func NewMaster(r io.Reader, net *chaincfg.Params) (string, error) {
+	seed := make([]byte, SeedLen)
+	if _, err := io.ReadFull(r, seed); err != nil {
+		return "", fmt.Errorf("couldn't read a seed: %w", err)
+	}
+
+	return NewMasterFromSeed(seed, net)
+}
+
+// NewMasterFromSeed generates the master extended private key for the network from the seed.
+func NewMasterFromSeed(seed []byte, net *chaincfg.Params) (string, error) {
+	master, err := hdkeychain.NewMaster(seed, net)
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate a master key: %w", err)
+	}
+
+	return master.String(), nil
+}
+
+// Export returns the extended key of the account m/purpose'/coin_type'/account' derived from the master key.
+// The key is the extended public key unless private is true.
+func Export(master string, purpose Purpose, account uint32, private bool, net *chaincfg.Params) (string, error) {
+	key, err := deriveAccount(master, purpose, account, net)
+	if err != nil {
+		return "", err
+	}
+
+	if !private {
+		key, err = key.Neuter()
+		if err != nil {
+			return "", fmt.Errorf("couldn't convert the key to the public one: %w", err)
+		}
+	}
+
+	key, err = key.CloneWithVersion(version(purpose, private, net))
+	if err != nil {
+		return "", fmt.Errorf("couldn't set the version of the key: %w", err)
+	}
+
+	return key.String(), nil
+}
+
+// Derive derives count keys from the index on the external chain (or the internal one if change is true)
+// of the account m/purpose'/coin_type'/account' with the master key.
+// All the indices must be non-hardened ones.
+func Derive(master string, purpose Purpose, account uint32, change bool, index, count uint32,
+	net *chaincfg.Params,
+) ([]Key, error) {
+	if uint64(index)+uint64(count) > hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("%w: %d keys from %d", errIndexRange, count, index)
+	}
+
+	addrType, err := purpose.addrType()
+	if err != nil {
+		return nil, err
+	}
+
+	accountKey, err := deriveAccount(master, purpose, account, net)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := uint32(0)
+	if change {
+		chain = 1
+	}
+
+	chainKey, err := accountKey.Derive(chain)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't derive the chain %d: %w", chain, err)
+	}
+
+	keys := []Key{}
+
+	for i := index; i < index+count; i++ {
+		k, err := chainKey.Derive(i)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't derive the index %d: %w", i, err)
+		}
+
+		privKey, err := k.ECPrivKey()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get the private key of the index %d: %w", i, err)
+		}
+
+		w, err := btcutil.NewWIF(privKey, net, true)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create a wif key: %w", err)
+		}
+
+		addr, err := wif.ExtractAddr(w.String(), addrType, net)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't extract the address of the index %d: %w", i, err)
+		}
+
+		keys = append(keys, Key{
+			Path: fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", purpose, net.HDCoinType, account, chain, i),
+			WIF:  w.String(),
+			Addr: addr,
+		})
+	}
+
+	return keys, nil
+}
+
+// deriveAccount derives the private key of the account m/purpose'/coin_type'/account' from the master key.
+func deriveAccount(master string, purpose Purpose, account uint32, net *chaincfg.Params) (*hdkeychain.ExtendedKey, error) {
+	if _, err := purpose.addrType(); err != nil {
+		return nil, err
+	}
+
+	if account >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("%w: %d", errAccountRange, account)
+	}
+
+	key, err := hdkeychain.NewKeyFromString(master)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the extended key: %w", err)
+	}
+
+	if !key.IsPrivate() || key.Depth() != 0 {
+		return nil, errNotMaster
+	}
+
+	if !key.IsForNet(net) {
+		return nil, fmt.Errorf("%w: %s", errWrongNetwork, net.Name)
+	}
+
+	for _, i := range []uint32{uint32(purpose), net.HDCoinType, account} {
+		key, err = key.Derive(hdkeychain.HardenedKeyStart + i)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't derive the hardened index %d: %w", i, err)
+		}
+	}
+
+	return key, nil
+}
+
+// addrType returns the type of addresses derived for the purpose.
+func (p Purpose) addrType() (wif.AddrType, error) {
+	switch p {
+	case PurposeBIP44:
+		return wif.AddrTypeP2PKH, nil
+	case PurposeBIP49:
+		return wif.AddrTypeP2SHP2WPKH, nil
+	case PurposeBIP84:
+		return wif.AddrTypeP2WPKH, nil
+	case PurposeBIP86:
+		return wif.AddrTypeP2TR, nil
+	default:
+		return "", fmt.Errorf("%w: %d", errUnknownPurpose, p)
+	}
+}
+
+// version returns the version bytes of extended keys for the purpose on the network.
+func version(purpose Purpose, private bool, net *chaincfg.Params) []byte {
+	mainNet := bytes.Equal(net.HDPrivateKeyID[:], chaincfg.MainNetParams.HDPrivateKeyID[:])
+
+	switch {
+	case purpose == PurposeBIP49 && mainNet:
+		return pick(private, mainNetBIP49PrivID, mainNetBIP49PubID)
+	case purpose == PurposeBIP49:
+		return pick(private, testNetBIP49PrivID, testNetBIP49PubID)
+	case purpose == PurposeBIP84 && mainNet:
+		return pick(private, mainNetBIP84PrivID, mainNetBIP84PubID)
+	case purpose == PurposeBIP84:
+		return pick(private, testNetBIP84PrivID, testNetBIP84PubID)
+	default:
+		return pick(private, net.HDPrivateKeyID[:], net.HDPublicKeyID[:])
+	}
+}
+
+func pick(private bool, priv, pub []byte) []byte {
+	if private {
+		return priv
+	}
+
+	return pub
+}
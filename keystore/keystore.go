@@ -0,0 +1,442 @@
+/*
+Package keystore stores WIFs encrypted with a passphrase in a local file
+
+- Open opens the keystore file, and Create sets the passphrase of a new one to be written by Save
+- Unlock derives the encryption key from the passphrase with scrypt
+- Add, Get and Delete handle WIFs by their labels with AES-GCM
+- SaveSession and LoadSession keep the keystore unlocked for a while with a session secret instead of the passphrase
+*/
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Parameters of scrypt for new keystores.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+	keyLen  = 32
+	saltLen = 16
+)
+
+const version = 1
+
+// checkPlaintext is encrypted in the keystore to tell whether a passphrase is right.
+var checkPlaintext = []byte("mybtc keystore")
+
+var (
+	errLocked          = errors.New("the keystore is locked")
+	errNotCreated      = errors.New("the keystore is not created")
+	errExists          = errors.New("the keystore already exists")
+	errWrongPassphrase = errors.New("the passphrase is wrong")
+	errNotFound        = errors.New("no key with the label")
+	errDuplicated      = errors.New("a key with the label already exists")
+	errEmptyLabel      = errors.New("the label is empty")
+	errUnknownVersion  = errors.New("unknown keystore version")
+	errNoSession       = errors.New("the keystore is not unlocked")
+	errShortData       = errors.New("the encrypted data is too short")
+)
+
+// Entry expresses a WIF in the keystore without the secret.
+type Entry struct {
+	Label   string `json:"label"`
+	Network string `json:"network"`
+}
+
+type entry struct {
+	Entry
+	// Data is the nonce and the WIF encrypted with the label as additional data in hex.
+	Data string `json:"data"`
+}
+
+type kdf struct {
+	Salt string `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+type file struct {
+	Version int     `json:"version"`
+	KDF     kdf     `json:"scrypt"`
+	Check   string  `json:"check"`
+	Keys    []entry `json:"keys"`
+}
+
+type session struct {
+	// Key is the nonce and the encryption key encrypted with the session secret in hex.
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+}
+
+// Keystore expresses an opened keystore file.
+type Keystore struct {
+	path string
+	file file
+	key  []byte
+}
+
+// Open opens the keystore at the path. The keystore is empty if the file doesn't exist.
+func Open(path string) (*Keystore, error) {
+	k := &Keystore{path: path, file: file{Version: version}}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return k, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("couldn't read the keystore: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &k.file); err != nil {
+		return nil, fmt.Errorf("couldn't parse the keystore: %w", err)
+	}
+
+	if k.file.Version != version {
+		return nil, fmt.Errorf("%w: %d", errUnknownVersion, k.file.Version)
+	}
+
+	return k, nil
+}
+
+// Create sets the passphrase of a new keystore and unlocks it.
+func (k *Keystore) Create(passphrase string) error {
+	if k.file.Check != "" {
+		return errExists
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("couldn't generate a salt: %w", err)
+	}
+
+	k.file.KDF = kdf{Salt: hex.EncodeToString(salt), N: scryptN, R: scryptR, P: scryptP}
+
+	key, err := k.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	check, err := seal(key, checkPlaintext, nil)
+	if err != nil {
+		return err
+	}
+
+	k.file.Check = check
+	k.key = key
+
+	return nil
+}
+
+// Unlock derives the encryption key from the passphrase and checks it.
+// The keystore must be created by Create first.
+func (k *Keystore) Unlock(passphrase string) error {
+	if k.file.Check == "" {
+		return errNotCreated
+	}
+
+	key, err := k.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := k.check(key); err != nil {
+		return err
+	}
+
+	k.key = key
+
+	return nil
+}
+
+func (k *Keystore) deriveKey(passphrase string) ([]byte, error) {
+	salt, err := hex.DecodeString(k.file.KDF.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the salt: %w", err)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, k.file.KDF.N, k.file.KDF.R, k.file.KDF.P, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't derive the key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (k *Keystore) check(key []byte) error {
+	p, err := open(key, k.file.Check, nil)
+	if err != nil || !bytes.Equal(p, checkPlaintext) {
+		return errWrongPassphrase
+	}
+
+	return nil
+}
+
+// List returns the entries in the keystore in the order they were added.
+func (k *Keystore) List() []Entry {
+	entries := make([]Entry, 0, len(k.file.Keys))
+	for _, e := range k.file.Keys {
+		entries = append(entries, e.Entry)
+	}
+
+	return entries
+}
+
+// Add adds the WIF for the network with the label. The keystore must be unlocked.
+func (k *Keystore) Add(label, wif, network string) error {
+	if k.key == nil {
+		return errLocked
+	}
+
+	if label == "" {
+		return errEmptyLabel
+	}
+
+	if k.find(label) >= 0 {
+		return fmt.Errorf("%w: %s", errDuplicated, label)
+	}
+
+	data, err := seal(k.key, []byte(wif), []byte(label))
+	if err != nil {
+		return err
+	}
+
+	k.file.Keys = append(k.file.Keys, entry{Entry: Entry{Label: label, Network: network}, Data: data})
+
+	return nil
+}
+
+// Get returns the WIF with the label. The keystore must be unlocked.
+func (k *Keystore) Get(label string) (string, error) {
+	if k.key == nil {
+		return "", errLocked
+	}
+
+	i := k.find(label)
+	if i < 0 {
+		return "", fmt.Errorf("%w: %s", errNotFound, label)
+	}
+
+	wif, err := open(k.key, k.file.Keys[i].Data, []byte(label))
+	if err != nil {
+		return "", fmt.Errorf("couldn't decrypt the key %s: %w", label, err)
+	}
+
+	return string(wif), nil
+}
+
+// Delete deletes the WIF with the label. The keystore must be unlocked.
+func (k *Keystore) Delete(label string) error {
+	if k.key == nil {
+		return errLocked
+	}
+
+	i := k.find(label)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", errNotFound, label)
+	}
+
+	k.file.Keys = append(k.file.Keys[:i], k.file.Keys[i+1:]...)
+
+	return nil
+}
+
+func (k *Keystore) find(label string) int {
+	for i, e := range k.file.Keys {
+		if e.Label == label {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Save writes the keystore to the file readable only by the owner.
+func (k *Keystore) Save() error {
+	b, err := json.MarshalIndent(k.file, "", "    ")
+	if err != nil {
+		return fmt.Errorf("couldn't serialize the keystore: %w", err)
+	}
+
+	return writeFile(k.path, b)
+}
+
+// SaveSession keeps the keystore unlocked for ttl, and returns the session secret in hex to unlock it by LoadSession.
+// The encryption key is saved next to the keystore encrypted with the secret, which is not saved anywhere.
+func (k *Keystore) SaveSession(ttl time.Duration) (string, error) {
+	if k.key == nil {
+		return "", errLocked
+	}
+
+	secret := make([]byte, keyLen)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("couldn't generate a session secret: %w", err)
+	}
+
+	s := session{Expires: time.Now().Add(ttl).UTC()}
+
+	// The expiry is authenticated not to be extended
+	key, err := seal(secret, k.key, []byte(s.Expires.Format(time.RFC3339Nano)))
+	if err != nil {
+		return "", err
+	}
+
+	s.Key = key
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("couldn't serialize the session: %w", err)
+	}
+
+	if err := writeFile(k.sessionPath(), b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// LoadSession unlocks the keystore with the saved session and its secret returned by SaveSession.
+// It fails with an expired session, which is removed then.
+func (k *Keystore) LoadSession(secret string) error {
+	if secret == "" {
+		return errNoSession
+	}
+
+	b, err := os.ReadFile(k.sessionPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return errNoSession
+	} else if err != nil {
+		return fmt.Errorf("couldn't read the session: %w", err)
+	}
+
+	var s session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("couldn't parse the session: %w", err)
+	}
+
+	if time.Now().After(s.Expires) {
+		if err := k.Lock(); err != nil {
+			return err
+		}
+
+		return errNoSession
+	}
+
+	sessionKey, err := hex.DecodeString(secret)
+	if err != nil {
+		return fmt.Errorf("couldn't decode the session secret: %w", err)
+	}
+
+	key, err := open(sessionKey, s.Key, []byte(s.Expires.UTC().Format(time.RFC3339Nano)))
+	if err != nil {
+		return fmt.Errorf("couldn't decrypt the session: %w", err)
+	}
+
+	if err := k.check(key); err != nil {
+		return fmt.Errorf("the session doesn't match the keystore: %w", err)
+	}
+
+	k.key = key
+
+	return nil
+}
+
+// Lock removes the saved session.
+func (k *Keystore) Lock() error {
+	k.key = nil
+
+	if err := os.Remove(k.sessionPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("couldn't remove the session: %w", err)
+	}
+
+	return nil
+}
+
+func (k *Keystore) sessionPath() string {
+	return k.path + ".session"
+}
+
+func writeFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("couldn't create the directory: %w", err)
+	}
+
+	// Write to a temporary file first not to break the file on errors
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("couldn't write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("couldn't replace %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// seal encrypts the plaintext with AES-GCM and returns the nonce and the ciphertext in hex.
+func seal(key, plaintext, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("couldn't generate a nonce: %w", err)
+	}
+
+	return hex.EncodeToString(gcm.Seal(nonce, nonce, plaintext, additionalData)), nil
+}
+
+// open decrypts the data sealed by seal.
+func open(key []byte, data string, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the encrypted data: %w", err)
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return nil, errShortData
+	}
+
+	p, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt the data: %w", err)
+	}
+
+	return p, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create a cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create a GCM: %w", err)
+	}
+
+	return gcm, nil
+}
@@ -25,9 +25,13 @@ import (
 
 func main() {
 	cmd.Execute(&cli.Env{
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-		Rand:   rand.Reader,
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Rand:      rand.Reader,
+		Prompt:    cli.TerminalPrompt,
+		LookupEnv: os.LookupEnv,
+		Keystore:  cli.DefaultKeystore(),
+		CacheDir:  cli.DefaultCacheDir(),
 	}, os.Args[1:])
 }
@@ -0,0 +1,359 @@
+/*
+Package message signs messages with WIFs and verifies the signatures against addresses
+
+- Sign makes a BIP137 signature for P2PKH and P2SH-P2WPKH addresses, or a BIP322 simple signature for P2WPKH and P2TR ones
+- Verify checks a BIP137 or BIP322 simple signature of a message for an address
+*/
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	mybtcwif "github.com/3f2cm/mybtc/wif"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// magic is prepended to messages signed in the legacy format.
+const magic = "Bitcoin Signed Message:\n"
+
+// bip322Tag is the tag of the tagged hash of messages signed along BIP322.
+const bip322Tag = "BIP0322-signed-message"
+
+// The first bytes of BIP137 signatures are the recovery ID plus these values by the address types.
+const (
+	headerP2PKHUncompressed = 27
+	headerP2PKHCompressed   = 31
+	headerP2SHP2WPKH        = 35
+	headerP2WPKH            = 39
+	headerMax               = 42
+	compactSigSize          = 65
+)
+
+var (
+	errInvalidSig     = errors.New("the signature is invalid for the address and the message")
+	errWrongNetwork   = errors.New("the address is not for the network")
+	errTrailingData   = errors.New("the signature has trailing data")
+	errUnsupportedSig = errors.New("BIP322 simple signatures are only for SegWit addresses")
+)
+
+// Sign signs the message with the WIF for its address of the type on the network, and returns the signature in base64.
+// The signature is in the BIP137 format for P2PKH and P2SH-P2WPKH, and in the BIP322 simple format for P2WPKH and P2TR.
+func Sign(s, msg string, t mybtcwif.AddrType, net *chaincfg.Params) (string, error) {
+	wif, err := mybtcwif.Decode(s, net)
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := mybtcwif.ExtractAddr(s, t, net)
+	if err != nil {
+		return "", err
+	}
+
+	var sig []byte
+
+	switch t {
+	case mybtcwif.AddrTypeP2PKH, mybtcwif.AddrTypeP2SHP2WPKH:
+		sig, err = signBIP137(wif, msg, t)
+	default:
+		sig, err = signBIP322(wif, msg, addr, t, net)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Verify checks the signature in base64 of the message for the address on the network.
+// 65-byte signatures are taken as BIP137 ones, and the others as BIP322 simple ones.
+// BIP137 signatures for compressed P2PKH are also accepted for the SegWit addresses of the same key as Electrum makes them.
+func Verify(addr, sig, msg string, net *chaincfg.Params) error {
+	a, err := btcutil.DecodeAddress(addr, net)
+	if err != nil {
+		return fmt.Errorf("couldn't decode the address: %w", err)
+	}
+
+	if !a.IsForNet(net) {
+		return fmt.Errorf("%w: %s", errWrongNetwork, net.Name)
+	}
+
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("couldn't decode the signature: %w", err)
+	}
+
+	if len(b) == compactSigSize && b[0] >= headerP2PKHUncompressed && b[0] <= headerMax {
+		return verifyBIP137(a, b, msg, net)
+	}
+
+	return verifyBIP322(a, b, msg)
+}
+
+// legacyHash returns the hash of the message signed in the BIP137 format.
+func legacyHash(msg string) []byte {
+	var buf bytes.Buffer
+
+	// writes to bytes.Buffer never fail
+	_ = wire.WriteVarString(&buf, 0, magic)
+	_ = wire.WriteVarString(&buf, 0, msg)
+
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+func signBIP137(wif *btcutil.WIF, msg string, t mybtcwif.AddrType) ([]byte, error) {
+	sig, err := ecdsa.SignCompact(wif.PrivKey, legacyHash(msg), wif.CompressPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign the message: %w", err)
+	}
+
+	if t == mybtcwif.AddrTypeP2SHP2WPKH {
+		// SignCompact adds headerP2PKHCompressed for compressed public keys
+		sig[0] += headerP2SHP2WPKH - headerP2PKHCompressed
+	}
+
+	return sig, nil
+}
+
+func verifyBIP137(addr btcutil.Address, sig []byte, msg string, net *chaincfg.Params) error {
+	header := sig[0]
+	recID := (header - headerP2PKHUncompressed) % 4
+
+	// RecoverCompact only knows the headers for P2PKH
+	compact := make([]byte, compactSigSize)
+	copy(compact, sig)
+	compact[0] = headerP2PKHUncompressed + recID
+
+	if header >= headerP2PKHCompressed {
+		compact[0] += headerP2PKHCompressed - headerP2PKHUncompressed
+	}
+
+	pubKey, compressed, err := ecdsa.RecoverCompact(compact, legacyHash(msg))
+	if err != nil {
+		return fmt.Errorf("%w: %s", errInvalidSig, err)
+	}
+
+	var candidates []mybtcwif.AddrType
+
+	switch {
+	case header < headerP2SHP2WPKH:
+		candidates = []mybtcwif.AddrType{mybtcwif.AddrTypeP2PKH}
+		if compressed {
+			candidates = append(candidates, mybtcwif.AddrTypeP2SHP2WPKH, mybtcwif.AddrTypeP2WPKH)
+		}
+	case header < headerP2WPKH:
+		candidates = []mybtcwif.AddrType{mybtcwif.AddrTypeP2SHP2WPKH}
+	default:
+		candidates = []mybtcwif.AddrType{mybtcwif.AddrTypeP2WPKH}
+	}
+
+	for _, t := range candidates {
+		a, err := pubKeyAddr(pubKey, compressed, t, net)
+		if err != nil {
+			continue
+		}
+
+		if a == addr.EncodeAddress() {
+			return nil
+		}
+	}
+
+	return errInvalidSig
+}
+
+// pubKeyAddr derives the address of the type from the public key.
+func pubKeyAddr(pubKey *btcec.PublicKey, compressed bool, t mybtcwif.AddrType, net *chaincfg.Params) (string, error) {
+	var (
+		addr btcutil.Address
+		err  error
+	)
+
+	switch t {
+	case mybtcwif.AddrTypeP2PKH:
+		serialized := pubKey.SerializeUncompressed()
+		if compressed {
+			serialized = pubKey.SerializeCompressed()
+		}
+
+		addr, err = btcutil.NewAddressPubKeyHash(btcutil.Hash160(serialized), net)
+	case mybtcwif.AddrTypeP2SHP2WPKH:
+		var program []byte
+
+		program, err = txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(btcutil.Hash160(pubKey.SerializeCompressed())).Script()
+		if err != nil {
+			break
+		}
+
+		addr, err = btcutil.NewAddressScriptHash(program, net)
+	default:
+		addr, err = btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(pubKey.SerializeCompressed()), net)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate an address with pubkey %x: %w", pubKey.SerializeCompressed(), err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// toSpend builds the virtual transaction of BIP322 whose output is spent to sign the message for the public key script.
+func toSpend(msg string, pkScript []byte) (*wire.MsgTx, error) {
+	hash := chainhash.TaggedHash([]byte(bip322Tag), []byte(msg))
+
+	sigScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(hash[:]).Script()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build the signature script: %w", err)
+	}
+
+	t := wire.NewMsgTx(0)
+	txIn := wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, wire.MaxPrevOutIndex), sigScript, nil)
+	txIn.Sequence = 0
+	t.AddTxIn(txIn)
+	t.AddTxOut(wire.NewTxOut(0, pkScript))
+
+	return t, nil
+}
+
+// toSign builds the virtual transaction of BIP322 spending the output of toSpend, whose witness is the signature.
+func toSign(spend *wire.MsgTx) *wire.MsgTx {
+	hash := spend.TxHash()
+
+	t := wire.NewMsgTx(0)
+	txIn := wire.NewTxIn(wire.NewOutPoint(&hash, 0), nil, nil)
+	txIn.Sequence = 0
+	t.AddTxIn(txIn)
+	t.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+
+	return t
+}
+
+func signBIP322(wif *btcutil.WIF, msg, addr string, t mybtcwif.AddrType, net *chaincfg.Params) ([]byte, error) {
+	a, err := btcutil.DecodeAddress(addr, net)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the address: %w", err)
+	}
+
+	pkScript, err := txscript.PayToAddrScript(a)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build the public key script: %w", err)
+	}
+
+	spend, err := toSpend(msg, pkScript)
+	if err != nil {
+		return nil, err
+	}
+
+	sign := toSign(spend)
+	sigHashes := txscript.NewTxSigHashes(sign, txscript.NewCannedPrevOutputFetcher(pkScript, 0))
+
+	var witness wire.TxWitness
+
+	if t == mybtcwif.AddrTypeP2TR {
+		witness, err = txscript.TaprootWitnessSignature(sign, sigHashes, 0, 0, pkScript, txscript.SigHashDefault, wif.PrivKey)
+	} else {
+		witness, err = txscript.WitnessSignature(sign, sigHashes, 0, 0, pkScript, txscript.SigHashAll, wif.PrivKey, true)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign the message: %w", err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeWitness(&buf, witness); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func verifyBIP322(addr btcutil.Address, sig []byte, msg string) error {
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return fmt.Errorf("couldn't build the public key script: %w", err)
+	}
+
+	if !txscript.IsWitnessProgram(pkScript) {
+		return errUnsupportedSig
+	}
+
+	witness, err := readWitness(bytes.NewReader(sig))
+	if err != nil {
+		return err
+	}
+
+	spend, err := toSpend(msg, pkScript)
+	if err != nil {
+		return err
+	}
+
+	sign := toSign(spend)
+	sign.TxIn[0].Witness = witness
+
+	prevOuts := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+
+	vm, err := txscript.NewEngine(pkScript, sign, 0, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(sign, prevOuts), 0, prevOuts)
+	if err != nil {
+		return fmt.Errorf("couldn't create the script engine: %w", err)
+	}
+
+	if err := vm.Execute(); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidSig, err)
+	}
+
+	return nil
+}
+
+// writeWitness serializes the witness stack in the same way as in transactions.
+func writeWitness(buf *bytes.Buffer, witness wire.TxWitness) error {
+	if err := wire.WriteVarInt(buf, 0, uint64(len(witness))); err != nil {
+		return fmt.Errorf("couldn't serialize the witness: %w", err)
+	}
+
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(buf, 0, item); err != nil {
+			return fmt.Errorf("couldn't serialize the witness: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readWitness deserializes the witness stack written by writeWitness.
+func readWitness(r *bytes.Reader) (wire.TxWitness, error) {
+	n, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the witness: %w", err)
+	}
+
+	// each item has one byte for its length at least
+	if n > uint64(r.Len()) {
+		return nil, fmt.Errorf("couldn't decode the witness: %d items in %d bytes", n, r.Len())
+	}
+
+	witness := make(wire.TxWitness, n)
+
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(r, 0, txscript.MaxScriptSize, "witness item")
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode the witness: %w", err)
+		}
+	}
+
+	if r.Len() > 0 {
+		return nil, errTrailingData
+	}
+
+	return witness, nil
+}
@@ -0,0 +1,74 @@
+/*
+Package mnemonic handles BIP39 mnemonic sentences
+
+- New generates a new mnemonic from entropy
+- Validate checks the words and the checksum of a mnemonic
+- Seed derives the seed for BIP32 master keys from a mnemonic and a passphrase
+*/
+package mnemonic
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/text/unicode/norm"
+)
+
+var errWordCount = errors.New("the number of words must be 12, 15, 18, 21 or 24")
+
+// New generates a new English mnemonic of the number of words from the entropy read from r.
+func New(r io.Reader, words int) (string, error) {
+	if !validWordCount(words) {
+		return "", errWordCount
+	}
+
+	// Each word has 11 bits, of which the entropy has 32 bits per 3 words and the rest is the checksum
+	entropy := make([]byte, words/3*4)
+	if _, err := io.ReadFull(r, entropy); err != nil {
+		return "", fmt.Errorf("couldn't read entropy: %w", err)
+	}
+
+	m, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate a mnemonic: %w", err)
+	}
+
+	return m, nil
+}
+
+// Validate checks that the mnemonic consists of words in the English wordlist with the valid checksum.
+func Validate(m string) error {
+	m = normalize(m)
+
+	if !validWordCount(len(strings.Fields(m))) {
+		return errWordCount
+	}
+
+	if _, err := bip39.MnemonicToByteArray(m); err != nil {
+		return fmt.Errorf("invalid mnemonic: %w", err)
+	}
+
+	return nil
+}
+
+// Seed derives the 64 bytes seed from the mnemonic and the passphrase, which can be empty.
+// Both are normalized to NFKD as BIP39 specifies.
+func Seed(m, passphrase string) ([]byte, error) {
+	if err := Validate(m); err != nil {
+		return nil, err
+	}
+
+	return bip39.NewSeed(normalize(m), norm.NFKD.String(passphrase)), nil
+}
+
+// normalize joins the words with single spaces, and normalizes them to NFKD.
+func normalize(m string) string {
+	return norm.NFKD.String(strings.Join(strings.Fields(m), " "))
+}
+
+func validWordCount(words int) bool {
+	return words >= 12 && words <= 24 && words%3 == 0
+}
@@ -0,0 +1,189 @@
+/*
+Package multisig builds m-of-n multisig scripts and their addresses
+
+- Script builds the OP_CHECKMULTISIG script from public keys (BIP67 sorted by default)
+- Address derives the P2SH, P2WSH or P2SH-P2WSH address of the script
+- ParseKey reads a public key in hex or the one of a WIF
+- Parse extracts the number of required signatures and the public keys from a script
+*/
+package multisig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	mybtcwif "github.com/3f2cm/mybtc/wif"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// AddrType expresses a type of addresses paying to a multisig script.
+type AddrType string
+
+const (
+	// AddrTypeP2SH is the type of legacy pay-to-script-hash addresses.
+	AddrTypeP2SH AddrType = "p2sh"
+	// AddrTypeP2SHP2WSH is the type of P2WSH addresses nested in P2SH.
+	AddrTypeP2SHP2WSH AddrType = "p2sh-p2wsh"
+	// AddrTypeP2WSH is the type of native SegWit v0 script hash addresses.
+	AddrTypeP2WSH AddrType = "p2wsh"
+)
+
+// MaxKeys is the maximum number of public keys in a script, which can be pushed with OP_1 to OP_16.
+const MaxKeys = 16
+
+var (
+	errInvalidM           = errors.New("the number of required signatures must be from 1 to the number of keys")
+	errTooManyKeys        = fmt.Errorf("the number of keys must be %d or less", MaxKeys)
+	errDuplicatedKey      = errors.New("the public key is duplicated")
+	errUncompressedSegWit = errors.New("SegWit scripts must have compressed public keys only")
+	errNotMultisig        = errors.New("the script is not a multisig script")
+	errTooLongScript      = fmt.Errorf("P2SH redeem scripts must be %d bytes or less", txscript.MaxScriptElementSize)
+)
+
+// Script builds the m-of-n multisig script of the public keys.
+// The keys are sorted in the lexicographic order (BIP67) if sorted is true.
+func Script(m int, pubKeys [][]byte, sorted bool) ([]byte, error) {
+	if len(pubKeys) > MaxKeys {
+		return nil, errTooManyKeys
+	}
+
+	if m < 1 || m > len(pubKeys) {
+		return nil, fmt.Errorf("%w: %d of %d", errInvalidM, m, len(pubKeys))
+	}
+
+	keys := make([][]byte, len(pubKeys))
+	copy(keys, pubKeys)
+
+	if sorted {
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	}
+
+	seen := map[string]bool{}
+	builder := txscript.NewScriptBuilder().AddInt64(int64(m))
+
+	for _, k := range keys {
+		if seen[string(k)] {
+			return nil, fmt.Errorf("%w: %x", errDuplicatedKey, k)
+		}
+
+		seen[string(k)] = true
+
+		builder.AddData(k)
+	}
+
+	script, err := builder.AddInt64(int64(len(keys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build the multisig script: %w", err)
+	}
+
+	return script, nil
+}
+
+// Address derives the address of the type on the network paying to the multisig script.
+// The redeem script for P2SH-P2WSH is the P2WSH witness program of the script.
+func Address(script []byte, t AddrType, net *chaincfg.Params) (string, error) {
+	var (
+		addr btcutil.Address
+		err  error
+	)
+
+	switch t {
+	case AddrTypeP2SH:
+		if len(script) > txscript.MaxScriptElementSize {
+			return "", errTooLongScript
+		}
+
+		addr, err = btcutil.NewAddressScriptHash(script, net)
+	case AddrTypeP2WSH, AddrTypeP2SHP2WSH:
+		if err := checkCompressed(script); err != nil {
+			return "", err
+		}
+
+		if t == AddrTypeP2WSH {
+			hash := sha256.Sum256(script)
+			addr, err = btcutil.NewAddressWitnessScriptHash(hash[:], net)
+
+			break
+		}
+
+		addr, err = btcutil.NewAddressScriptHash(WitnessProgram(script), net)
+	default:
+		return "", fmt.Errorf("unknown address type: %s", t)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to generate an address with script %x: %w", script, err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// WitnessProgram returns the P2WSH witness program of the witness script.
+func WitnessProgram(witnessScript []byte) []byte {
+	hash := sha256.Sum256(witnessScript)
+
+	// OP_0 <32-byte hash> doesn't fail to build
+	program, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(hash[:]).Script()
+
+	return program
+}
+
+// ParseKey parses the public key in hex, or the WIF for the network.
+// The public key of a WIF is serialized as its compression flag.
+func ParseKey(s string, net *chaincfg.Params) ([]byte, error) {
+	if b, err := hex.DecodeString(s); err == nil {
+		if _, err := btcec.ParsePubKey(b); err != nil {
+			return nil, fmt.Errorf("couldn't parse the public key %s: %w", s, err)
+		}
+
+		return b, nil
+	}
+
+	wif, err := mybtcwif.Decode(s, net)
+	if err != nil {
+		return nil, fmt.Errorf("the key is neither a public key in hex nor a WIF: %w", err)
+	}
+
+	return wif.SerializePubKey(), nil
+}
+
+func checkCompressed(script []byte) error {
+	_, pushes, err := Parse(script)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range pushes {
+		if len(k) != btcec.PubKeyBytesLenCompressed {
+			return errUncompressedSegWit
+		}
+	}
+
+	return nil
+}
+
+// Parse returns the number of required signatures and the public keys of the multisig script.
+func Parse(script []byte) (int, [][]byte, error) {
+	if ok, err := txscript.IsMultisigScript(script); err != nil || !ok {
+		return 0, nil, errNotMultisig
+	}
+
+	pubKeys, err := txscript.PushedData(script)
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't parse the script: %w", err)
+	}
+
+	_, m, err := txscript.CalcMultiSigStats(script)
+	if err != nil {
+		return 0, nil, fmt.Errorf("couldn't parse the script: %w", err)
+	}
+
+	return m, pubKeys, nil
+}
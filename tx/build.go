@@ -0,0 +1,130 @@
+package tx
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/3f2cm/mybtc/coinselect"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// BuildInput expresses an input to build a transaction by choosing UTXOs to spend.
+// UTXOs have the same format as "utxos" in the output of utxo list --format json.
+type BuildInput struct {
+	UTXOs   []In     `json:"utxos"`
+	Outs    []Out    `json:"outs"`
+	FeeRate float64  `json:"feerate"`
+	Change  string   `json:"change"`
+	WIFs    []string `json:"wifs"`
+}
+
+var errNoUTXO = errors.New("there are no UTXOs to spend")
+
+// Build chooses UTXOs to spend for the outputs on the network at the fee rate and returns the input to Generate.
+// The returned input has the change address only when the change output is needed.
+func Build(b *BuildInput, net *chaincfg.Params, passphrase PassphraseFunc) (*Input, error) {
+	if len(b.UTXOs) == 0 {
+		return nil, errNoUTXO
+	}
+
+	if len(b.Outs) == 0 {
+		return nil, errEmptyTxOut
+	}
+
+	if b.FeeRate <= 0 {
+		return nil, errNoFeeRate
+	}
+
+	if b.Change == "" {
+		return nil, errNoChange
+	}
+
+	wdb, err := decodeWIFs(b.WIFs, net, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode WIFs in the input: %w", err)
+	}
+
+	params, err := selectionParams(b, net)
+	if err != nil {
+		return nil, err
+	}
+
+	coins := make([]coinselect.Coin, len(b.UTXOs))
+	for i, utxo := range b.UTXOs {
+		inSize, inWitnessWeight, err := estimateTxInSize(utxo, wdb)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't estimate the size to spend %s:%d: %w", utxo.TxID, utxo.Vout, err)
+		}
+
+		coins[i] = coinselect.Coin{
+			Value:      utxo.Value,
+			InputVSize: (inSize*4 + inWitnessWeight + 3) / 4,
+		}
+	}
+
+	res, err := coinselect.Select(coins, *params)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't choose UTXOs to spend: %w", err)
+	}
+
+	input := &Input{
+		Ins:  make([]In, 0, len(res.Indices)),
+		Outs: b.Outs,
+		WIFs: b.WIFs,
+	}
+
+	for _, i := range res.Indices {
+		input.Ins = append(input.Ins, b.UTXOs[i])
+	}
+
+	// Without the change output, the excess goes to the fee
+	if res.Change {
+		input.FeeRate = b.FeeRate
+		input.Change = b.Change
+	}
+
+	return input, nil
+}
+
+// selectionParams calculates the conditions of the coin selection from the outputs.
+func selectionParams(b *BuildInput, net *chaincfg.Params) (*coinselect.Params, error) {
+	target := int64(0)
+	for _, out := range b.Outs {
+		target += out.Value
+	}
+
+	// The transaction without inputs and the change output
+	baseVSize, err := estimateVSize(&Input{Outs: b.Outs}, nil, net)
+	if err != nil {
+		return nil, err
+	}
+
+	// The number of inputs is at most the number of UTXOs, and the marker and flag for witnesses are rounded up
+	baseVSize += wire.VarIntSerializeSize(uint64(len(b.UTXOs))) - wire.VarIntSerializeSize(0) + 1
+
+	changeScript, err := payToAddrScript(b.Change, net)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't use the change address: %w", err)
+	}
+
+	// Spending the change output is assumed to be signed with a compressed public key
+	changeSpendSize, changeSpendWitnessWeight, err := estimateTxInSize(In{ScriptPubKey: hex.EncodeToString(changeScript)}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if txscript.GetScriptClass(changeScript) == txscript.PubKeyHashTy {
+		changeSpendSize -= p2pkhUncompressedSigScriptSize - p2pkhCompressedSigScriptSize
+	}
+
+	return &coinselect.Params{
+		Target:           target,
+		FeeRate:          b.FeeRate,
+		BaseVSize:        baseVSize,
+		ChangeVSize:      wire.NewTxOut(0, changeScript).SerializeSize(),
+		ChangeSpendVSize: (changeSpendSize*4 + changeSpendWitnessWeight + 3) / 4,
+	}, nil
+}
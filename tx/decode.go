@@ -0,0 +1,129 @@
+package tx
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// Decoded describes a transaction in the same shape as decoderawtransaction of bitcoind.
+type Decoded struct {
+	TxID     string       `json:"txid"`
+	Hash     string       `json:"hash"`
+	Version  int32        `json:"version"`
+	Size     int          `json:"size"`
+	VSize    int          `json:"vsize"`
+	Weight   int          `json:"weight"`
+	LockTime uint32       `json:"locktime"`
+	Vin      []DecodedIn  `json:"vin"`
+	Vout     []DecodedOut `json:"vout"`
+}
+
+// DecodedIn describes a TxIn.
+// Coinbase is set instead of TxID, Vout and ScriptSig for coinbase transactions.
+type DecodedIn struct {
+	Coinbase  string         `json:"coinbase,omitempty"`
+	TxID      string         `json:"txid,omitempty"`
+	Vout      *uint32        `json:"vout,omitempty"`
+	ScriptSig *DecodedScript `json:"scriptSig,omitempty"`
+	Witness   []string       `json:"txinwitness,omitempty"`
+	Sequence  uint32         `json:"sequence"`
+}
+
+// DecodedOut describes a TxOut, whose value is in BTC.
+type DecodedOut struct {
+	Value        float64       `json:"value"`
+	N            int           `json:"n"`
+	ScriptPubKey DecodedScript `json:"scriptPubKey"`
+}
+
+// DecodedScript describes a script.
+// Address and Type are only for public key scripts.
+type DecodedScript struct {
+	Asm     string `json:"asm"`
+	Hex     string `json:"hex"`
+	Address string `json:"address,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// Decode decodes the raw transaction in hex and describes it with the addresses on the network.
+func Decode(rawTx string, net *chaincfg.Params) (*Decoded, error) {
+	msgTx, err := decodeMsgTx(strings.TrimSpace(rawTx))
+	if err != nil {
+		return nil, err
+	}
+
+	t := btcutil.NewTx(msgTx)
+	weight := int(blockchain.GetTransactionWeight(t))
+
+	d := &Decoded{
+		TxID:     msgTx.TxHash().String(),
+		Hash:     msgTx.WitnessHash().String(),
+		Version:  msgTx.Version,
+		Size:     msgTx.SerializeSize(),
+		VSize:    (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor,
+		Weight:   weight,
+		LockTime: msgTx.LockTime,
+		Vin:      make([]DecodedIn, 0, len(msgTx.TxIn)),
+		Vout:     make([]DecodedOut, 0, len(msgTx.TxOut)),
+	}
+
+	coinbase := blockchain.IsCoinBaseTx(msgTx)
+
+	for _, txIn := range msgTx.TxIn {
+		in := DecodedIn{Sequence: txIn.Sequence}
+
+		if coinbase {
+			in.Coinbase = hex.EncodeToString(txIn.SignatureScript)
+		} else {
+			vout := txIn.PreviousOutPoint.Index
+			in.TxID = txIn.PreviousOutPoint.Hash.String()
+			in.Vout = &vout
+			in.ScriptSig = &DecodedScript{
+				Asm: disasm(txIn.SignatureScript),
+				Hex: hex.EncodeToString(txIn.SignatureScript),
+			}
+		}
+
+		for _, item := range txIn.Witness {
+			in.Witness = append(in.Witness, hex.EncodeToString(item))
+		}
+
+		d.Vin = append(d.Vin, in)
+	}
+
+	for i, txOut := range msgTx.TxOut {
+		class, addrs, _, _ := txscript.ExtractPkScriptAddrs(txOut.PkScript, net)
+
+		out := DecodedOut{
+			Value: btcutil.Amount(txOut.Value).ToBTC(),
+			N:     i,
+			ScriptPubKey: DecodedScript{
+				Asm:  disasm(txOut.PkScript),
+				Hex:  hex.EncodeToString(txOut.PkScript),
+				Type: class.String(),
+			},
+		}
+
+		// bitcoind doesn't show addresses for P2PK and bare multisig outputs
+		if len(addrs) == 1 && class != txscript.PubKeyTy && class != txscript.MultiSigTy {
+			out.ScriptPubKey.Address = addrs[0].EncodeAddress()
+		}
+
+		d.Vout = append(d.Vout, out)
+	}
+
+	return d, nil
+}
+
+// disasm disassembles the script.
+// Broken scripts are disassembled as far as possible and end with [error] instead of failing.
+func disasm(script []byte) string {
+	s, _ := txscript.DisasmString(script)
+
+	return s
+}
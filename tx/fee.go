@@ -0,0 +1,202 @@
+package tx
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Estimated sizes of the parts of signed transactions.
+// Signatures are assumed to be the longest ones with the sighash type (73 bytes).
+const (
+	// version 4, locktime 4
+	txOverheadSize = 4 + 4
+	// marker 1, flag 1 in weight units
+	txWitnessOverheadWeight = 1 + 1
+	// outpoint 36, sequence 4
+	txInOverheadSize = 36 + 4
+	// OP_DATA_73 sig OP_DATA_33 pubkey
+	p2pkhCompressedSigScriptSize = 1 + 73 + 1 + 33
+	// OP_DATA_73 sig OP_DATA_65 pubkey
+	p2pkhUncompressedSigScriptSize = 1 + 73 + 1 + 65
+	// OP_DATA_22 <P2WPKH witness program>
+	p2shP2WPKHSigScriptSize = 1 + 22
+	// item count, sig and compressed pubkey with their lengths
+	p2wpkhWitnessWeight = 1 + 1 + 73 + 1 + 33
+	// item count, schnorr sig with SigHashDefault and its length
+	p2trKeyPathWitnessWeight = 1 + 1 + 64
+)
+
+var (
+	errNoChange       = errors.New("the change address is required to pay the fee at the fee rate")
+	errNoFeeRate      = errors.New("the fee rate is required to make a change output")
+	errNoInputValue   = errors.New("the values of all the previous outputs are required to calculate the fee")
+	errInsufficientIn = errors.New("the input values are insufficient for the outputs and the fee")
+)
+
+// addChange adds the change output to the input so that the transaction pays the fee at input.FeeRate.
+// The change output is dropped if it would be dust, and then the rest goes to the fee.
+// wdb is used to know whether P2PKH inputs are signed with compressed public keys,
+// and they are assumed to be uncompressed without wdb.
+func addChange(input *Input, wdb wifDB, net *chaincfg.Params) error {
+	if input.FeeRate <= 0 && input.Change == "" {
+		return nil
+	}
+
+	if input.FeeRate <= 0 {
+		return errNoFeeRate
+	}
+
+	if input.Change == "" {
+		return errNoChange
+	}
+
+	changeScript, err := payToAddrScript(input.Change, net)
+	if err != nil {
+		return fmt.Errorf("couldn't use the change address: %w", err)
+	}
+
+	inValue := int64(0)
+	for _, txin := range input.Ins {
+		if txin.Value <= 0 {
+			return fmt.Errorf("couldn't calculate the fee for %s:%d: %w", txin.TxID, txin.Vout, errNoInputValue)
+		}
+
+		inValue += txin.Value
+	}
+
+	outValue := int64(0)
+	for _, out := range input.Outs {
+		outValue += out.Value
+	}
+
+	// Estimate the size without the change output first
+	vsize, err := estimateVSize(input, wdb, net)
+	if err != nil {
+		return err
+	}
+
+	fee := calcFee(input.FeeRate, vsize)
+	if inValue-outValue < fee {
+		return fmt.Errorf("%w: in %d, out %d, fee %d", errInsufficientIn, inValue, outValue, fee)
+	}
+
+	changeOut := wire.NewTxOut(0, changeScript)
+	vsizeWithChange := vsize + changeOut.SerializeSize()
+	// The number of outputs may need a longer varint
+	vsizeWithChange += wire.VarIntSerializeSize(uint64(len(input.Outs)+1)) - wire.VarIntSerializeSize(uint64(len(input.Outs)))
+
+	changeOut.Value = inValue - outValue - calcFee(input.FeeRate, vsizeWithChange)
+	if changeOut.Value < dustThreshold(changeOut) {
+		return nil
+	}
+
+	input.Outs = append(input.Outs, Out{Addr: input.Change, Value: changeOut.Value})
+
+	return nil
+}
+
+// dustThreshold calculates the dust limit of the output at the minimum dust relay fee of 3 sat/B
+// in the same way as GetDustThreshold in btcd's mempool package.
+func dustThreshold(txOut *wire.TxOut) int64 {
+	// the output and a typical input spending it with a sig (72 bytes) and a compressed pubkey
+	totalSize := txOut.SerializeSize() + txInOverheadSize + 1
+	if txscript.IsWitnessProgram(txOut.PkScript) {
+		totalSize += 107 / 4
+	} else {
+		totalSize += 107
+	}
+
+	return 3 * int64(totalSize)
+}
+
+// calcFee calculates the fee in satoshi for the vsize at the fee rate in sat/vB.
+func calcFee(feeRate float64, vsize int) int64 {
+	return int64(math.Ceil(feeRate * float64(vsize)))
+}
+
+// estimateVSize estimates the virtual size of the signed transaction built from the input.
+func estimateVSize(input *Input, wdb wifDB, net *chaincfg.Params) (int, error) {
+	baseSize := txOverheadSize + wire.VarIntSerializeSize(uint64(len(input.Ins))) +
+		wire.VarIntSerializeSize(uint64(len(input.Outs)))
+	witnessWeight := 0
+	legacyIns := 0
+
+	for _, txin := range input.Ins {
+		inSize, inWitnessWeight, err := estimateTxInSize(txin, wdb)
+		if err != nil {
+			return 0, err
+		}
+
+		baseSize += inSize
+		witnessWeight += inWitnessWeight
+
+		if inWitnessWeight == 0 {
+			legacyIns++
+		}
+	}
+
+	for _, out := range input.Outs {
+		payToAddrScript, err := payToAddrScript(out.Addr, net)
+		if err != nil {
+			return 0, err
+		}
+
+		baseSize += wire.NewTxOut(out.Value, payToAddrScript).SerializeSize()
+	}
+
+	weight := baseSize * 4
+	if witnessWeight > 0 {
+		// inputs without witnesses have an empty witness of 1 byte in SegWit transactions
+		weight += txWitnessOverheadWeight + witnessWeight + legacyIns
+	}
+
+	return (weight + 3) / 4, nil
+}
+
+// estimateTxInSize estimates the size without witness and the weight of witness of the signed TxIn.
+func estimateTxInSize(txin In, wdb wifDB) (int, int, error) {
+	prevPubKeyScriptBytes, err := hex.DecodeString(txin.ScriptPubKey)
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't decode the previous public key script: %w", err)
+	}
+
+	if isMultisig(txin) {
+		mi, err := parseMultisigIn(txin, prevPubKeyScriptBytes)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		inSize, inWitnessWeight := mi.estimateSize()
+
+		return inSize, inWitnessWeight, nil
+	}
+
+	prevPubKeyScript, err := txscript.ParsePkScript(prevPubKeyScriptBytes)
+	if err != nil {
+		return 0, 0, fmt.Errorf("couldn't parse the given public key script: %w", err)
+	}
+
+	switch prevPubKeyScript.Class() {
+	case txscript.PubKeyHashTy:
+		sigScriptSize := p2pkhUncompressedSigScriptSize
+		if wif, err := wdb.find(prevPubKeyScript); err == nil && wif.CompressPubKey {
+			sigScriptSize = p2pkhCompressedSigScriptSize
+		}
+
+		return txInOverheadSize + wire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize, 0, nil
+	case txscript.WitnessV0PubKeyHashTy:
+		return txInOverheadSize + 1, p2wpkhWitnessWeight, nil
+	case txscript.ScriptHashTy:
+		return txInOverheadSize + 1 + p2shP2WPKHSigScriptSize, p2wpkhWitnessWeight, nil
+	case txscript.WitnessV1TaprootTy:
+		return txInOverheadSize + 1, p2trKeyPathWitnessWeight, nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported public key script type: %s", prevPubKeyScript.Class())
+	}
+}
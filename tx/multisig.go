@@ -0,0 +1,343 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/3f2cm/mybtc/multisig"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	errScriptMismatch         = errors.New("the script doesn't match the public key script")
+	errNoRedeemScript         = errors.New("the redeem script or the witness script is required to spend P2SH multisig outputs")
+	errNoWitnessScript        = errors.New("the witness script is required to spend P2WSH outputs")
+	errUnexpectedRedeemScript = errors.New("P2WSH outputs are spent without the redeem script")
+	errSigMismatch            = errors.New("the signature doesn't match any public key in the multisig script")
+)
+
+// multisigInput expresses the scripts to spend a P2SH, P2WSH or P2SH-P2WSH multisig output.
+type multisigInput struct {
+	// redeemScript is pushed in the signature script for P2SH and P2SH-P2WSH.
+	redeemScript []byte
+	// witnessScript is put at the end of the witness for P2WSH and P2SH-P2WSH.
+	witnessScript []byte
+	// script is the multisig script to be signed, which is the witness script if any.
+	script  []byte
+	m       int
+	pubKeys [][]byte
+}
+
+// isMultisig tells whether the In spends a multisig output.
+func isMultisig(txin In) bool {
+	return txin.RedeemScript != "" || txin.WitnessScript != ""
+}
+
+// parseMultisigIn decodes the scripts of the In spending a multisig output.
+func parseMultisigIn(txin In, prevPubKeyScript []byte) (*multisigInput, error) {
+	redeemScript, err := hex.DecodeString(txin.RedeemScript)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the redeem script: %w", err)
+	}
+
+	witnessScript, err := hex.DecodeString(txin.WitnessScript)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the witness script: %w", err)
+	}
+
+	return newMultisigInput(prevPubKeyScript, redeemScript, witnessScript)
+}
+
+// newMultisigInput checks that the scripts spend the public key script and parses the multisig script.
+// The redeem script of P2SH-P2WSH can be omitted, and it is derived from the witness script.
+func newMultisigInput(prevPubKeyScript, redeemScript, witnessScript []byte) (*multisigInput, error) {
+	mi := &multisigInput{}
+
+	switch {
+	case txscript.IsPayToWitnessScriptHash(prevPubKeyScript):
+		if len(witnessScript) == 0 {
+			return nil, errNoWitnessScript
+		}
+
+		if len(redeemScript) > 0 {
+			return nil, errUnexpectedRedeemScript
+		}
+
+		if !bytes.Equal(multisig.WitnessProgram(witnessScript), prevPubKeyScript) {
+			return nil, fmt.Errorf("%w: witness script %x", errScriptMismatch, witnessScript)
+		}
+
+		mi.witnessScript = witnessScript
+		mi.script = witnessScript
+	case txscript.IsPayToScriptHash(prevPubKeyScript):
+		switch {
+		case len(witnessScript) > 0:
+			program := multisig.WitnessProgram(witnessScript)
+			if len(redeemScript) > 0 && !bytes.Equal(redeemScript, program) {
+				return nil, fmt.Errorf("%w: witness script %x", errScriptMismatch, witnessScript)
+			}
+
+			mi.redeemScript = program
+			mi.witnessScript = witnessScript
+			mi.script = witnessScript
+		case len(redeemScript) > 0:
+			mi.redeemScript = redeemScript
+			mi.script = redeemScript
+		default:
+			return nil, errNoRedeemScript
+		}
+
+		// OP_HASH160 <20-byte hash> OP_EQUAL
+		if !bytes.Equal(btcutil.Hash160(mi.redeemScript), prevPubKeyScript[2:22]) {
+			return nil, fmt.Errorf("%w: redeem script %x", errScriptMismatch, mi.redeemScript)
+		}
+	default:
+		return nil, fmt.Errorf("%w: scripts are given for %x", errScriptMismatch, prevPubKeyScript)
+	}
+
+	m, pubKeys, err := multisig.Parse(mi.script)
+	if err != nil {
+		return nil, err
+	}
+
+	mi.m = m
+	mi.pubKeys = pubKeys
+
+	return mi, nil
+}
+
+// witness tells whether the output is spent with the witness.
+func (mi *multisigInput) witness() bool {
+	return mi.witnessScript != nil
+}
+
+// sign signs the input with the WIF for the multisig script.
+func (mi *multisigInput) sign(t *wire.MsgTx, idx int, value int64, sigHashes *txscript.TxSigHashes,
+	wif *btcutil.WIF,
+) ([]byte, error) {
+	var (
+		sig []byte
+		err error
+	)
+
+	if mi.witness() {
+		// The script code is the witness script itself (BIP143)
+		sig, err = txscript.RawTxInWitnessSignature(t, sigHashes, idx, value, mi.script, txscript.SigHashAll, wif.PrivKey)
+	} else {
+		sig, err = txscript.RawTxInSignature(t, idx, mi.script, txscript.SigHashAll, wif.PrivKey)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate a signature for the tx: %w", err)
+	}
+
+	return sig, nil
+}
+
+// verify tells whether the signature with the sighash type is valid for the public key.
+func (mi *multisigInput) verify(t *wire.MsgTx, idx int, value int64, sigHashes *txscript.TxSigHashes,
+	sig, pubKey []byte,
+) bool {
+	if len(sig) == 0 {
+		return false
+	}
+
+	hashType := txscript.SigHashType(sig[len(sig)-1])
+
+	var (
+		hash []byte
+		err  error
+	)
+
+	if mi.witness() {
+		hash, err = txscript.CalcWitnessSigHash(mi.script, sigHashes, hashType, t, idx, value)
+	} else {
+		hash, err = txscript.CalcSignatureHash(mi.script, hashType, t, idx)
+	}
+
+	if err != nil {
+		return false
+	}
+
+	signature, err := ecdsa.ParseDERSignature(sig[:len(sig)-1])
+	if err != nil {
+		return false
+	}
+
+	key, err := btcec.ParsePubKey(pubKey)
+	if err != nil {
+		return false
+	}
+
+	return signature.Verify(hash, key)
+}
+
+// signatures returns up to m signatures in the order of the public keys in the script.
+// They are the given ones by the other cosigners and the ones made with the WIFs in wdb.
+func (mi *multisigInput) signatures(t *wire.MsgTx, idx int, value int64, sigHashes *txscript.TxSigHashes,
+	given []string, wdb wifDB,
+) ([][]byte, error) {
+	sigs := make([][]byte, len(mi.pubKeys))
+
+	for _, s := range given {
+		sig, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode the signature: %w", err)
+		}
+
+		found := false
+
+		for i, pubKey := range mi.pubKeys {
+			if mi.verify(t, idx, value, sigHashes, sig, pubKey) {
+				sigs[i] = sig
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errSigMismatch, s)
+		}
+	}
+
+	for i, pubKey := range mi.pubKeys {
+		if sigs[i] != nil {
+			continue
+		}
+
+		wif := wdb.findPubKey(pubKey)
+		if wif == nil {
+			continue
+		}
+
+		sig, err := mi.sign(t, idx, value, sigHashes, wif)
+		if err != nil {
+			return nil, err
+		}
+
+		sigs[i] = sig
+	}
+
+	ordered := make([][]byte, 0, mi.m)
+
+	for _, sig := range sigs {
+		if sig != nil && len(ordered) < mi.m {
+			ordered = append(ordered, sig)
+		}
+	}
+
+	if len(ordered) == 0 {
+		return nil, errWIFNotFound
+	}
+
+	return ordered, nil
+}
+
+// apply puts the signatures and the scripts into the TxIn.
+// The TxIn is left partially signed if there are fewer signatures than m.
+func (mi *multisigInput) apply(txIn *wire.TxIn, sigs [][]byte) error {
+	if !mi.witness() {
+		// OP_CHECKMULTISIG pops one more item than the signatures
+		builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+		for _, sig := range sigs {
+			builder.AddData(sig)
+		}
+
+		sigScript, err := builder.AddData(mi.redeemScript).Script()
+		if err != nil {
+			return fmt.Errorf("couldn't build a signature script: %w", err)
+		}
+
+		txIn.SignatureScript = sigScript
+
+		return nil
+	}
+
+	witness := wire.TxWitness{nil}
+	witness = append(witness, sigs...)
+	txIn.Witness = append(witness, mi.witnessScript)
+
+	if mi.redeemScript != nil {
+		// The signature script only pushes the P2WSH witness program
+		sigScript, err := txscript.NewScriptBuilder().AddData(mi.redeemScript).Script()
+		if err != nil {
+			return fmt.Errorf("couldn't build a signature script: %w", err)
+		}
+
+		txIn.SignatureScript = sigScript
+	}
+
+	return nil
+}
+
+// estimateSize estimates the size without witness and the weight of witness of the TxIn signed by m keys.
+func (mi *multisigInput) estimateSize() (int, int) {
+	sigsSize := mi.m * (1 + 73)
+
+	if !mi.witness() {
+		sigScriptSize := 1 + sigsSize + pushSize(len(mi.redeemScript))
+
+		return txInOverheadSize + wire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize, 0
+	}
+
+	sigScriptSize := 0
+	if mi.redeemScript != nil {
+		sigScriptSize = pushSize(len(mi.redeemScript))
+	}
+
+	// item count, the empty item, sigs and the witness script
+	witnessWeight := wire.VarIntSerializeSize(uint64(mi.m+2)) + 1 + sigsSize +
+		wire.VarIntSerializeSize(uint64(len(mi.witnessScript))) + len(mi.witnessScript)
+
+	return txInOverheadSize + wire.VarIntSerializeSize(uint64(sigScriptSize)) + sigScriptSize, witnessWeight
+}
+
+// pushSize returns the size to push data of the length in scripts.
+func pushSize(n int) int {
+	switch {
+	case n < txscript.OP_PUSHDATA1:
+		return 1 + n
+	case n <= 0xff:
+		return 2 + n
+	default:
+		return 3 + n
+	}
+}
+
+// signMultisig signs the TxIn spending the multisig output with the WIFs and the signatures given in the In.
+func signMultisig(t *wire.MsgTx, idx int, txin In, prevPubKeyScript []byte, sigHashes *txscript.TxSigHashes,
+	wdb wifDB,
+) error {
+	mi, err := parseMultisigIn(txin, prevPubKeyScript)
+	if err != nil {
+		return err
+	}
+
+	if mi.witness() && txin.Value <= 0 {
+		return errNoValue
+	}
+
+	sigs, err := mi.signatures(t, idx, txin.Value, sigHashes, txin.Sigs, wdb)
+	if err != nil {
+		return err
+	}
+
+	return mi.apply(t.TxIn[idx], sigs)
+}
+
+// findPubKey finds the WIF of the serialized public key.
+func (w wifDB) findPubKey(pubKey []byte) *btcutil.WIF {
+	wif, ok := w[hex.EncodeToString(btcutil.Hash160(pubKey))]
+	if !ok || !bytes.Equal(wif.SerializePubKey(), pubKey) {
+		return nil
+	}
+
+	return wif
+}
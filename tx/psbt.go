@@ -0,0 +1,577 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	mybtcwif "github.com/3f2cm/mybtc/wif"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	errNoPrevTx       = errors.New("the raw previous transaction is required for legacy inputs in PSBTs")
+	errNoPrevOut      = errors.New("there is no UTXO info in the PSBT input; add it with update")
+	errEmptyPSBTs     = errors.New("there are no PSBTs to combine")
+	errDifferentPSBTs = errors.New("PSBTs for different transactions can't be combined")
+)
+
+// CreatePSBT creates a base64 encoded PSBT (BIP174) on the network from the given input.
+// The PSBT contains the UTXO info of each In and the change output if FeeRate is given,
+// and WIFs in the input are ignored.
+func CreatePSBT(b []byte, net *chaincfg.Params) (string, error) {
+	input, err := parseInput(b)
+	if err != nil {
+		return "", err
+	}
+
+	// P2PKH inputs are assumed to be signed with uncompressed public keys without WIFs
+	if err := addChange(input, nil, net); err != nil {
+		return "", fmt.Errorf("couldn't add the change output: %w", err)
+	}
+
+	msgTx, err := newMsgTx(input, net)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := psbt.NewFromUnsignedTx(msgTx)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create a PSBT from the unsigned tx: %w", err)
+	}
+
+	if err := updatePrevOuts(p, input.Ins); err != nil {
+		return "", err
+	}
+
+	return encodePSBT(p)
+}
+
+// UpdatePSBT adds the UTXO info of Ins in the given input to the corresponding inputs of the PSBT.
+// Outs and WIFs in the input are ignored.
+func UpdatePSBT(encPSBT string, b []byte) (string, error) {
+	p, err := decodePSBT(encPSBT)
+	if err != nil {
+		return "", err
+	}
+
+	var input Input
+	if err := json.Unmarshal(b, &input); err != nil {
+		return "", fmt.Errorf("couldn't parse given input: %w", err)
+	}
+
+	if len(input.Ins) == 0 {
+		return "", errEmptyTxIn
+	}
+
+	if err := updatePrevOuts(p, input.Ins); err != nil {
+		return "", err
+	}
+
+	return encodePSBT(p)
+}
+
+// SignPSBT adds signatures to the inputs of the PSBT which can be signed with the given WIFs for the network.
+// The other inputs are left as they are to be signed by others.
+// BIP38 encrypted keys in the WIFs are decrypted with the passphrase.
+func SignPSBT(encPSBT string, wifs []string, net *chaincfg.Params, passphrase PassphraseFunc) (string, error) {
+	p, err := decodePSBT(encPSBT)
+	if err != nil {
+		return "", err
+	}
+
+	wdb, err := decodeWIFs(wifs, net, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("couldn't decode given WIFs: %w", err)
+	}
+
+	// All the previous outputs are needed for SegWit signatures
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+
+	for i := range p.Inputs {
+		prevOut, err := prevOutOf(p, i)
+		if err != nil {
+			return "", fmt.Errorf("couldn't sign the input %d: %w", i, err)
+		}
+
+		prevOutFetcher.AddPrevOut(p.UnsignedTx.TxIn[i].PreviousOutPoint, prevOut)
+	}
+
+	sigHashes := txscript.NewTxSigHashes(p.UnsignedTx, prevOutFetcher)
+
+	u, err := psbt.NewUpdater(p)
+	if err != nil {
+		return "", fmt.Errorf("couldn't update the PSBT: %w", err)
+	}
+
+	for i := range p.Inputs {
+		if err := signPSBTInput(u, i, prevOutFetcher, sigHashes, wdb); err != nil {
+			return "", fmt.Errorf("couldn't sign the input %d: %w", i, err)
+		}
+	}
+
+	return encodePSBT(p)
+}
+
+// CombinePSBT merges the given PSBTs for the same transaction into one.
+func CombinePSBT(encPSBTs []string) (string, error) {
+	if len(encPSBTs) == 0 {
+		return "", errEmptyPSBTs
+	}
+
+	combined, err := decodePSBT(encPSBTs[0])
+	if err != nil {
+		return "", err
+	}
+
+	for _, encPSBT := range encPSBTs[1:] {
+		p, err := decodePSBT(encPSBT)
+		if err != nil {
+			return "", err
+		}
+
+		if p.UnsignedTx.TxHash() != combined.UnsignedTx.TxHash() {
+			return "", errDifferentPSBTs
+		}
+
+		for i := range combined.Inputs {
+			mergePInput(&combined.Inputs[i], &p.Inputs[i])
+		}
+
+		for i := range combined.Outputs {
+			mergePOutput(&combined.Outputs[i], &p.Outputs[i])
+		}
+	}
+
+	return encodePSBT(combined)
+}
+
+// FinalizePSBT builds the final signature scripts and witnesses of all the inputs of the PSBT.
+func FinalizePSBT(encPSBT string) (string, error) {
+	p, err := decodePSBT(encPSBT)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range p.Inputs {
+		if err := trimMultisigSigs(p, i); err != nil {
+			return "", fmt.Errorf("couldn't finalize the input %d: %w", i, err)
+		}
+
+		ok, err := psbt.MaybeFinalize(p, i)
+		if err != nil {
+			return "", fmt.Errorf("couldn't finalize the input %d: %w", i, err)
+		}
+
+		if !ok {
+			return "", fmt.Errorf("couldn't finalize the input %d: %w", i, psbt.ErrNotFinalizable)
+		}
+	}
+
+	return encodePSBT(p)
+}
+
+// ExtractPSBT extracts the signed transaction from the finalized PSBT.
+func ExtractPSBT(encPSBT string) ([]byte, error) {
+	p, err := decodePSBT(encPSBT)
+	if err != nil {
+		return nil, err
+	}
+
+	msgTx, err := psbt.Extract(p)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't extract the transaction from the PSBT: %w", err)
+	}
+
+	var signedTx bytes.Buffer
+	if err := msgTx.Serialize(&signedTx); err != nil {
+		return nil, fmt.Errorf("couldn't serialize the extracted transaction: %w", err)
+	}
+
+	return signedTx.Bytes(), nil
+}
+
+func decodePSBT(encPSBT string) (*psbt.Packet, error) {
+	p, err := psbt.NewFromRawBytes(bytes.NewReader([]byte(encPSBT)), true)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode given PSBT: %w", err)
+	}
+
+	return p, nil
+}
+
+func encodePSBT(p *psbt.Packet) (string, error) {
+	s, err := p.B64Encode()
+	if err != nil {
+		return "", fmt.Errorf("couldn't encode the PSBT: %w", err)
+	}
+
+	return s, nil
+}
+
+// updatePrevOuts adds the UTXO info of the given Ins to the PSBT inputs with the same outpoints.
+func updatePrevOuts(p *psbt.Packet, ins []In) error {
+	u, err := psbt.NewUpdater(p)
+	if err != nil {
+		return fmt.Errorf("couldn't update the PSBT: %w", err)
+	}
+
+	for _, txin := range ins {
+		idx, err := findPSBTInput(p, txin)
+		if err != nil {
+			return err
+		}
+
+		prevPubKeyScriptBytes, err := hex.DecodeString(txin.ScriptPubKey)
+		if err != nil {
+			return fmt.Errorf("couldn't decode the previous public key script: %w", err)
+		}
+
+		if txin.PrevTx != "" {
+			prevTx, err := decodeMsgTx(txin.PrevTx)
+			if err != nil {
+				return fmt.Errorf("couldn't decode the previous transaction of %s:%d: %w", txin.TxID, txin.Vout, err)
+			}
+
+			if err := u.AddInNonWitnessUtxo(prevTx, idx); err != nil {
+				return fmt.Errorf("couldn't add the previous transaction of %s:%d: %w", txin.TxID, txin.Vout, err)
+			}
+		}
+
+		var mi *multisigInput
+		if isMultisig(txin) {
+			mi, err = parseMultisigIn(txin, prevPubKeyScriptBytes)
+			if err != nil {
+				return fmt.Errorf("couldn't add the scripts of %s:%d: %w", txin.TxID, txin.Vout, err)
+			}
+
+			if err := addMultisigScripts(u, idx, mi); err != nil {
+				return fmt.Errorf("couldn't add the scripts of %s:%d: %w", txin.TxID, txin.Vout, err)
+			}
+		}
+
+		// Legacy inputs need the whole previous transaction while SegWit ones need only the previous output
+		legacy := !txscript.IsWitnessProgram(prevPubKeyScriptBytes) &&
+			(!txscript.IsPayToScriptHash(prevPubKeyScriptBytes) || (mi != nil && !mi.witness()))
+		if legacy {
+			if txin.PrevTx == "" {
+				return fmt.Errorf("couldn't add UTXO info of %s:%d: %w", txin.TxID, txin.Vout, errNoPrevTx)
+			}
+
+			continue
+		}
+
+		if txin.Value <= 0 {
+			return fmt.Errorf("couldn't add UTXO info of %s:%d: %w", txin.TxID, txin.Vout, errNoValue)
+		}
+
+		if err := u.AddInWitnessUtxo(wire.NewTxOut(txin.Value, prevPubKeyScriptBytes), idx); err != nil {
+			return fmt.Errorf("couldn't add UTXO info of %s:%d: %w", txin.TxID, txin.Vout, err)
+		}
+	}
+
+	return nil
+}
+
+func findPSBTInput(p *psbt.Packet, txin In) (int, error) {
+	txidHash, err := chainhash.NewHashFromStr(txin.TxID)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't create a hash from txid: %w", err)
+	}
+
+	outPoint := wire.NewOutPoint(txidHash, txin.Vout)
+	for i, in := range p.UnsignedTx.TxIn {
+		if in.PreviousOutPoint == *outPoint {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("there is no input spending %s in the PSBT", outPoint)
+}
+
+func decodeMsgTx(s string) (*wire.MsgTx, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the hex string: %w", err)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err := msgTx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("couldn't deserialize the transaction: %w", err)
+	}
+
+	return msgTx, nil
+}
+
+// prevOutOf returns the previous output spent by the PSBT input.
+func prevOutOf(p *psbt.Packet, idx int) (*wire.TxOut, error) {
+	pInput := p.Inputs[idx]
+
+	if pInput.WitnessUtxo != nil {
+		return pInput.WitnessUtxo, nil
+	}
+
+	if pInput.NonWitnessUtxo != nil {
+		vout := p.UnsignedTx.TxIn[idx].PreviousOutPoint.Index
+		if int(vout) >= len(pInput.NonWitnessUtxo.TxOut) {
+			return nil, fmt.Errorf("the previous transaction doesn't have the output %d", vout)
+		}
+
+		return pInput.NonWitnessUtxo.TxOut[vout], nil
+	}
+
+	return nil, errNoPrevOut
+}
+
+func signPSBTInput(u *psbt.Updater, idx int, prevOutFetcher txscript.PrevOutputFetcher,
+	sigHashes *txscript.TxSigHashes, wdb wifDB,
+) error {
+	p := u.Upsbt
+	pInput := &p.Inputs[idx]
+
+	if pInput.FinalScriptSig != nil || pInput.FinalScriptWitness != nil {
+		return nil
+	}
+
+	prevOut := prevOutFetcher.FetchPrevOutput(p.UnsignedTx.TxIn[idx].PreviousOutPoint)
+
+	prevPubKeyScript, err := txscript.ParsePkScript(prevOut.PkScript)
+	if err != nil {
+		return fmt.Errorf("couldn't parse the previous public key script: %w", err)
+	}
+
+	if pInput.WitnessScript != nil || (pInput.RedeemScript != nil && !txscript.IsWitnessProgram(pInput.RedeemScript)) {
+		mi, err := newMultisigInput(prevOut.PkScript, pInput.RedeemScript, pInput.WitnessScript)
+		if err != nil {
+			return err
+		}
+
+		return signPSBTMultisigInput(u, idx, prevOut, sigHashes, wdb, mi)
+	}
+
+	// The input may be signed by others
+	wif, err := wdb.find(prevPubKeyScript)
+	if errors.Is(err, errWIFNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	pubKey := wif.SerializePubKey()
+	if hasPartialSig(pInput.PartialSigs, pubKey) {
+		return nil
+	}
+
+	var (
+		sig          []byte
+		redeemScript []byte
+	)
+
+	switch prevPubKeyScript.Class() {
+	case txscript.PubKeyHashTy:
+		sig, err = txscript.RawTxInSignature(p.UnsignedTx, idx, prevOut.PkScript, txscript.SigHashAll, wif.PrivKey)
+	case txscript.WitnessV0PubKeyHashTy:
+		sig, err = txscript.RawTxInWitnessSignature(p.UnsignedTx, sigHashes, idx, prevOut.Value,
+			prevOut.PkScript, txscript.SigHashAll, wif.PrivKey)
+	case txscript.ScriptHashTy:
+		redeemScript, err = mybtcwif.NestedWitnessRedeemScript(wif)
+		if err != nil {
+			return fmt.Errorf("couldn't generate a redeem script: %w", err)
+		}
+
+		sig, err = txscript.RawTxInWitnessSignature(p.UnsignedTx, sigHashes, idx, prevOut.Value,
+			redeemScript, txscript.SigHashAll, wif.PrivKey)
+	case txscript.WitnessV1TaprootTy:
+		return signPSBTTaprootInput(p.UnsignedTx, pInput, idx, prevOut, sigHashes, wif)
+	default:
+		return fmt.Errorf("unsupported public key script type: %s", prevPubKeyScript.Class())
+	}
+
+	if err != nil {
+		return fmt.Errorf("couldn't generate a signature for the tx: %w", err)
+	}
+
+	if _, err := u.Sign(idx, sig, pubKey, redeemScript, nil); err != nil {
+		return fmt.Errorf("couldn't add the signature to the PSBT: %w", err)
+	}
+
+	return nil
+}
+
+// signPSBTMultisigInput adds signatures with the WIFs for the public keys in the multisig script
+// until the number of signatures reaches the required one.
+func signPSBTMultisigInput(u *psbt.Updater, idx int, prevOut *wire.TxOut, sigHashes *txscript.TxSigHashes,
+	wdb wifDB, mi *multisigInput,
+) error {
+	pInput := &u.Upsbt.Inputs[idx]
+
+	for _, pubKey := range mi.pubKeys {
+		if len(pInput.PartialSigs) >= mi.m {
+			return nil
+		}
+
+		wif := wdb.findPubKey(pubKey)
+		if wif == nil || hasPartialSig(pInput.PartialSigs, pubKey) {
+			continue
+		}
+
+		sig, err := mi.sign(u.Upsbt.UnsignedTx, idx, prevOut.Value, sigHashes, wif)
+		if err != nil {
+			return err
+		}
+
+		if _, err := u.Sign(idx, sig, pubKey, pInput.RedeemScript, pInput.WitnessScript); err != nil {
+			return fmt.Errorf("couldn't add the signature to the PSBT: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// trimMultisigSigs drops the extra signatures of the multisig input,
+// which can't be finalized with more signatures than required.
+func trimMultisigSigs(p *psbt.Packet, idx int) error {
+	pInput := &p.Inputs[idx]
+
+	script := pInput.WitnessScript
+	if script == nil {
+		script = pInput.RedeemScript
+	}
+
+	if script == nil || txscript.GetScriptClass(script) != txscript.MultiSigTy {
+		return nil
+	}
+
+	_, m, err := txscript.CalcMultiSigStats(script)
+	if err != nil {
+		return fmt.Errorf("couldn't parse the multisig script: %w", err)
+	}
+
+	if len(pInput.PartialSigs) > m {
+		pInput.PartialSigs = pInput.PartialSigs[:m]
+	}
+
+	return nil
+}
+
+// addMultisigScripts adds the redeem script and the witness script to the PSBT input.
+func addMultisigScripts(u *psbt.Updater, idx int, mi *multisigInput) error {
+	if mi.redeemScript != nil {
+		if err := u.AddInRedeemScript(mi.redeemScript, idx); err != nil {
+			return fmt.Errorf("couldn't add the redeem script: %w", err)
+		}
+	}
+
+	if mi.witnessScript != nil {
+		if err := u.AddInWitnessScript(mi.witnessScript, idx); err != nil {
+			return fmt.Errorf("couldn't add the witness script: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func signPSBTTaprootInput(t *wire.MsgTx, pInput *psbt.PInput, idx int, prevOut *wire.TxOut,
+	sigHashes *txscript.TxSigHashes, wif *btcutil.WIF,
+) error {
+	if pInput.TaprootKeySpendSig != nil {
+		return nil
+	}
+
+	// The private key is tweaked with the empty script tree inside (BIP86)
+	sig, err := txscript.RawTxInTaprootSignature(t, sigHashes, idx, prevOut.Value,
+		prevOut.PkScript, []byte{}, txscript.SigHashDefault, wif.PrivKey)
+	if err != nil {
+		return fmt.Errorf("couldn't generate a signature for the tx: %w", err)
+	}
+
+	pInput.TaprootKeySpendSig = sig
+	pInput.TaprootInternalKey = schnorr.SerializePubKey(wif.PrivKey.PubKey())
+
+	return nil
+}
+
+// mergePInput merges the fields of src into dst which are missing in dst.
+func mergePInput(dst, src *psbt.PInput) {
+	if dst.NonWitnessUtxo == nil {
+		dst.NonWitnessUtxo = src.NonWitnessUtxo
+	}
+
+	if dst.WitnessUtxo == nil {
+		dst.WitnessUtxo = src.WitnessUtxo
+	}
+
+	if dst.SighashType == 0 {
+		dst.SighashType = src.SighashType
+	}
+
+	dst.RedeemScript = mergeBytes(dst.RedeemScript, src.RedeemScript)
+	dst.WitnessScript = mergeBytes(dst.WitnessScript, src.WitnessScript)
+	dst.FinalScriptSig = mergeBytes(dst.FinalScriptSig, src.FinalScriptSig)
+	dst.FinalScriptWitness = mergeBytes(dst.FinalScriptWitness, src.FinalScriptWitness)
+	dst.TaprootKeySpendSig = mergeBytes(dst.TaprootKeySpendSig, src.TaprootKeySpendSig)
+	dst.TaprootInternalKey = mergeBytes(dst.TaprootInternalKey, src.TaprootInternalKey)
+	dst.TaprootMerkleRoot = mergeBytes(dst.TaprootMerkleRoot, src.TaprootMerkleRoot)
+
+	for _, ps := range src.PartialSigs {
+		if !hasPartialSig(dst.PartialSigs, ps.PubKey) {
+			dst.PartialSigs = append(dst.PartialSigs, ps)
+		}
+	}
+
+	for _, d := range src.Bip32Derivation {
+		if !hasBip32Derivation(dst.Bip32Derivation, d.PubKey) {
+			dst.Bip32Derivation = append(dst.Bip32Derivation, d)
+		}
+	}
+}
+
+// mergePOutput merges the fields of src into dst which are missing in dst.
+func mergePOutput(dst, src *psbt.POutput) {
+	dst.RedeemScript = mergeBytes(dst.RedeemScript, src.RedeemScript)
+	dst.WitnessScript = mergeBytes(dst.WitnessScript, src.WitnessScript)
+	dst.TaprootInternalKey = mergeBytes(dst.TaprootInternalKey, src.TaprootInternalKey)
+	dst.TaprootTapTree = mergeBytes(dst.TaprootTapTree, src.TaprootTapTree)
+
+	for _, d := range src.Bip32Derivation {
+		if !hasBip32Derivation(dst.Bip32Derivation, d.PubKey) {
+			dst.Bip32Derivation = append(dst.Bip32Derivation, d)
+		}
+	}
+}
+
+func mergeBytes(dst, src []byte) []byte {
+	if dst == nil {
+		return src
+	}
+
+	return dst
+}
+
+func hasPartialSig(sigs []*psbt.PartialSig, pubKey []byte) bool {
+	for _, s := range sigs {
+		if bytes.Equal(s.PubKey, pubKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasBip32Derivation(ds []*psbt.Bip32Derivation, pubKey []byte) bool {
+	for _, d := range ds {
+		if bytes.Equal(d.PubKey, pubKey) {
+			return true
+		}
+	}
+
+	return false
+}
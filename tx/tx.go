@@ -2,6 +2,11 @@
 Package tx provides functions handling transactions
 
 - Generate generates a new signed transaction from an input
+- Decode describes a raw transaction like decoderawtransaction of bitcoind
+- Verify runs the scripts of a raw transaction against the previous outputs
+
+Generate can sign inputs spending P2PKH, P2WPKH, P2SH-P2WPKH and P2TR (BIP86 key-path) outputs,
+and P2SH, P2WSH and P2SH-P2WSH multisig outputs.
 */
 package tx
 
@@ -12,6 +17,9 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/3f2cm/mybtc/bip38"
+	mybtcwif "github.com/3f2cm/mybtc/wif"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -24,6 +32,19 @@ type In struct {
 	TxID         string `json:"txid"`
 	Vout         uint32 `json:"vout"`
 	ScriptPubKey string `json:"scriptpubkey"`
+	// Value is the amount of the previous output in satoshi.
+	// It is required to sign SegWit inputs (BIP143), and for every input
+	// when any of the inputs spends a taproot output (BIP341).
+	Value int64 `json:"value,omitempty"`
+	// PrevTx is the raw previous transaction in hex.
+	// It is required only for legacy inputs in PSBTs (BIP174).
+	PrevTx string `json:"prevtx,omitempty"`
+	// RedeemScript is the multisig script in hex to spend a P2SH multisig output.
+	RedeemScript string `json:"redeemscript,omitempty"`
+	// WitnessScript is the multisig script in hex to spend a P2WSH or P2SH-P2WSH multisig output.
+	WitnessScript string `json:"witnessscript,omitempty"`
+	// Sigs are the signatures in hex for the multisig script made by the other cosigners.
+	Sigs []string `json:"sigs,omitempty"`
 }
 
 // Out contains necessary info to establish transaction message's TxOut items.
@@ -37,19 +58,87 @@ type Input struct {
 	Ins  []In     `json:"ins"`
 	Outs []Out    `json:"outs"`
 	WIFs []string `json:"wifs"`
+	// Keys are the labels of WIFs in the keystore to sign with in addition to WIFs.
+	Keys []string `json:"keys,omitempty"`
+	// FeeRate is the target fee rate in sat/vB.
+	// When it is given with Change, the change output is added to pay the fee at the rate.
+	FeeRate float64 `json:"feerate,omitempty"`
+	// Change is the address to receive the change.
+	Change string `json:"change,omitempty"`
 }
 
-// wifDB stores WIFs with keys of their public key hashes.
+// PassphraseFunc supplies the passphrase to decrypt BIP38 encrypted keys given as WIFs.
+// It is called only when there are encrypted keys.
+type PassphraseFunc func() (string, error)
+
+// KeyFunc returns the WIF with the label in the keystore.
+type KeyFunc func(label string) (string, error)
+
+// wifDB stores WIFs with keys of their public key hashes, of their P2SH-P2WPKH script hashes
+// and of their x-only taproot output keys (BIP86).
 type wifDB map[string]*btcutil.WIF
 
 var (
-	errEmptyTxIn  = errors.New("there are no TxIn items in the input")
-	errEmptyTxOut = errors.New("there are no TxOut items in the input")
+	errEmptyTxIn    = errors.New("there are no TxIn items in the input")
+	errEmptyTxOut   = errors.New("there are no TxOut items in the input")
+	errNoValue      = errors.New("the value of the previous output is required to sign SegWit inputs")
+	errNoAllValue   = errors.New("the values of all the previous outputs are required to sign taproot inputs")
+	errWIFNotFound  = errors.New("couldn't find WIF corresponding to the public key script in given WIFs")
+	errAddrNetwork  = errors.New("the address is not for the network")
+	errNoPassphrase = errors.New("the passphrase is required to decrypt BIP38 encrypted keys")
+	errNoKeystore   = errors.New("the keystore is required to sign with keys")
 )
 
-// Generate generates a transaction with signatures from given input.
-func Generate(b []byte) ([]byte, error) {
+// Generate generates a transaction with signatures on the network from given input.
+// Multisig inputs are signed with the WIFs and Sigs of each In, and they are left partially signed
+// when there are fewer signatures than required.
+// WIFs in the input can be BIP38 encrypted keys, which are decrypted with the passphrase,
+// and keys in the input are looked up with key.
+func Generate(b []byte, net *chaincfg.Params, passphrase PassphraseFunc, key KeyFunc) ([]byte, error) {
 	// Deserialize the given input
+	input, err := parseInput(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up keys in the keystore
+	wifs, err := lookupKeys(input, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode WIFs in the input
+	wdb, err := decodeWIFs(wifs, net, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode WIFs in the input: %w", err)
+	}
+
+	// Add the change output paying the fee at the fee rate
+	if err := addChange(input, wdb, net); err != nil {
+		return nil, fmt.Errorf("couldn't add the change output: %w", err)
+	}
+
+	// Initialize msgTx to construct it and insert a signature into its TxIn
+	msgTx, err := newMsgTx(input, net)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add signatures to msgTx.TxIn
+	if err := updateSignatures(msgTx, input.Ins, wdb); err != nil {
+		return nil, fmt.Errorf("couldn't sign msgTx: %w", err)
+	}
+
+	// Serialize and hexdump the msgTx with signs
+	var signedTx bytes.Buffer
+	if err := msgTx.Serialize(&signedTx); err != nil {
+		return nil, fmt.Errorf("couldn't serialize the built signed transaction: %w", err)
+	}
+
+	return signedTx.Bytes(), nil
+}
+
+func parseInput(b []byte) (*Input, error) {
 	var input Input
 	if err := json.Unmarshal(b, &input); err != nil {
 		return nil, fmt.Errorf("couldn't parse given input: %w", err)
@@ -63,11 +152,15 @@ func Generate(b []byte) ([]byte, error) {
 		return nil, errEmptyTxOut
 	}
 
-	// Initialize msgTx to construct it and insert a signature into its TxIn
+	return &input, nil
+}
+
+// newMsgTx constructs an unsigned transaction message from the given input.
+func newMsgTx(input *Input, net *chaincfg.Params) (*wire.MsgTx, error) {
 	msgTx := wire.NewMsgTx(wire.TxVersion)
 
 	// Construct msgTx.TxOut
-	if err := addOutToTx(msgTx, input.Outs); err != nil {
+	if err := addOutToTx(msgTx, input.Outs, net); err != nil {
 		return nil, fmt.Errorf("couldn't construct TxOut for msgTx: %w", err)
 	}
 
@@ -76,36 +169,14 @@ func Generate(b []byte) ([]byte, error) {
 		return nil, fmt.Errorf("couldn't construct TxIn for msgTx: %w", err)
 	}
 
-	// Decode WIFs in the input
-	wdb, err := decodeWIFs(input.WIFs)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't decode WIFs in the input: %w", err)
-	}
-
-	// Add signatures to msgTx.TxIn
-	if err := updateSignatures(msgTx, input.Ins, wdb); err != nil {
-		return nil, fmt.Errorf("couldn't sign msgTx: %w", err)
-	}
-
-	// Serialize and hexdump the msgTx with signs
-	var signedTx bytes.Buffer
-	if err := msgTx.Serialize(&signedTx); err != nil {
-		return nil, fmt.Errorf("couldn't serialize the built signed transaction: %w", err)
-	}
-
-	return signedTx.Bytes(), nil
+	return msgTx, nil
 }
 
-func addOutToTx(t *wire.MsgTx, outs []Out) error {
+func addOutToTx(t *wire.MsgTx, outs []Out, net *chaincfg.Params) error {
 	for _, out := range outs {
-		addr, err := btcutil.DecodeAddress(out.Addr, &chaincfg.TestNet3Params)
-		if err != nil {
-			return fmt.Errorf("couldn't decode given address '%s': %w", out.Addr, err)
-		}
-
-		payToAddrScript, err := txscript.PayToAddrScript(addr)
+		payToAddrScript, err := payToAddrScript(out.Addr, net)
 		if err != nil {
-			return fmt.Errorf("couldn't generate a script to pay: %w", err)
+			return err
 		}
 
 		txOut := wire.NewTxOut(out.Value, payToAddrScript)
@@ -130,58 +201,308 @@ func addInToTx(t *wire.MsgTx, ins []In) error {
 	return nil
 }
 
-func decodeWIFs(wifs []string) (wifDB, error) {
+// payToAddrScript generates the script to pay to the address, which must be for the network.
+func payToAddrScript(s string, net *chaincfg.Params) ([]byte, error) {
+	addr, err := btcutil.DecodeAddress(s, net)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode given address '%s': %w", s, err)
+	}
+
+	if !addr.IsForNet(net) {
+		return nil, fmt.Errorf("%w: '%s' for %s", errAddrNetwork, s, net.Name)
+	}
+
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't generate a script to pay: %w", err)
+	}
+
+	return script, nil
+}
+
+func decodeWIFs(wifs []string, net *chaincfg.Params, passphrase PassphraseFunc) (wifDB, error) {
 	w := make(wifDB)
 
 	for _, encWIF := range wifs {
-		wif, err := btcutil.DecodeWIF(encWIF)
+		wif, err := decodeWIF(encWIF, net, passphrase)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't decode given WIF: %w", err)
+			return nil, err
 		}
 
 		pubKey := wif.SerializePubKey()
 		pubKeyHash := btcutil.Hash160(pubKey)
 		pubKeyHashEnc := hex.EncodeToString(pubKeyHash)
 		w[pubKeyHashEnc] = wif
+
+		// Nested SegWit outputs commit to the hash of the P2WPKH witness program
+		if wif.CompressPubKey {
+			redeemScript, err := mybtcwif.NestedWitnessRedeemScript(wif)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't generate a redeem script for given WIF: %w", err)
+			}
+
+			w[hex.EncodeToString(btcutil.Hash160(redeemScript))] = wif
+		}
+
+		// Key-path spendable taproot outputs commit to the key tweaked with an empty script tree (BIP86)
+		taprootKey := txscript.ComputeTaprootKeyNoScript(wif.PrivKey.PubKey())
+		taprootKeyEnc := hex.EncodeToString(schnorr.SerializePubKey(taprootKey))
+		w[taprootKeyEnc] = wif
 	}
 
 	return w, nil
 }
 
+// lookupKeys returns the WIFs in the input with the ones of the keys in the input.
+func lookupKeys(input *Input, key KeyFunc) ([]string, error) {
+	if len(input.Keys) == 0 {
+		return input.WIFs, nil
+	}
+
+	if key == nil {
+		return nil, errNoKeystore
+	}
+
+	wifs := append([]string{}, input.WIFs...)
+
+	for _, label := range input.Keys {
+		w, err := key(label)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get the key %s: %w", label, err)
+		}
+
+		wifs = append(wifs, w)
+	}
+
+	return wifs, nil
+}
+
+// decodeWIF decodes the WIF, or decrypts it with the passphrase if it is a BIP38 encrypted key.
+func decodeWIF(s string, net *chaincfg.Params, passphrase PassphraseFunc) (*btcutil.WIF, error) {
+	if !bip38.IsEncrypted(s) {
+		wif, err := mybtcwif.Decode(s, net)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode given WIF: %w", err)
+		}
+
+		return wif, nil
+	}
+
+	if passphrase == nil {
+		return nil, errNoPassphrase
+	}
+
+	p, err := passphrase()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get the passphrase: %w", err)
+	}
+
+	wif, err := bip38.Decrypt(s, p, net)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt given BIP38 key: %w", err)
+	}
+
+	return wif, nil
+}
+
+// find finds the WIF which can sign the given public key script.
+func (w wifDB) find(prevPubKeyScript txscript.PkScript) (*btcutil.WIF, error) {
+	var key []byte
+
+	script := prevPubKeyScript.Script()
+
+	switch prevPubKeyScript.Class() {
+	case txscript.PubKeyHashTy:
+		key = extractPubKeyHash(script)
+	case txscript.WitnessV0PubKeyHashTy:
+		key = extractWitnessPubKeyHash(script)
+	case txscript.ScriptHashTy:
+		// only P2SH-P2WPKH is indexed in wifDB
+		key = extractScriptHash(script)
+	case txscript.WitnessV1TaprootTy:
+		key = extractTaprootOutputKey(script)
+	default:
+		return nil, fmt.Errorf("unsupported public key script type: %s", prevPubKeyScript.Class())
+	}
+
+	if key == nil {
+		return nil, errors.New("couldn't extract a key from the public key script")
+	}
+
+	wif, ok := w[hex.EncodeToString(key)]
+	if !ok {
+		return nil, errWIFNotFound
+	}
+
+	// SegWit v0 only accepts compressed public keys (BIP143)
+	if (prevPubKeyScript.Class() == txscript.WitnessV0PubKeyHashTy || prevPubKeyScript.Class() == txscript.ScriptHashTy) &&
+		!wif.CompressPubKey {
+		return nil, errors.New("SegWit inputs must be signed with a WIF for a compressed public key")
+	}
+
+	return wif, nil
+}
+
 func updateSignatures(t *wire.MsgTx, ins []In, wdb wifDB) error {
-	// Add a signature to each TxIn in msgTx.TxIn
+	// Parse the public key scripts in the input
+	prevPubKeyScripts := make([]txscript.PkScript, len(ins))
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(nil)
+
 	for i, txin := range ins {
-		// Parse the public key script in the input
 		prevPubKeyScriptBytes, err := hex.DecodeString(txin.ScriptPubKey)
 		if err != nil {
 			return fmt.Errorf("couldn't decode the previous public key script: %w", err)
 		}
 
-		// Extract the PubKey hash from the public key script
 		prevPubKeyScript, err := txscript.ParsePkScript(prevPubKeyScriptBytes)
 		if err != nil {
 			return fmt.Errorf("couldn't parse the given public key script: %w", err)
 		}
 
-		pubKeyHash := extractPubKeyHash(prevPubKeyScript.Script())
-		if pubKeyHash == nil {
-			return fmt.Errorf("couldn't generate an address from the public key script: %w", err)
+		prevPubKeyScripts[i] = prevPubKeyScript
+		prevOutFetcher.AddPrevOut(t.TxIn[i].PreviousOutPoint, wire.NewTxOut(txin.Value, prevPubKeyScriptBytes))
+	}
+
+	// Taproot signatures commit to the values of all the previous outputs (BIP341)
+	if err := checkTaprootValues(ins, prevPubKeyScripts); err != nil {
+		return err
+	}
+
+	// SegWit signatures commit to the whole set of previous outputs (BIP143)
+	sigHashes := txscript.NewTxSigHashes(t, prevOutFetcher)
+
+	// Add a signature to each TxIn in msgTx.TxIn
+	for i, txin := range ins {
+		prevPubKeyScript := prevPubKeyScripts[i]
+
+		// Multisig inputs may be signed partially
+		if isMultisig(txin) {
+			if err := signMultisig(t, i, txin, prevPubKeyScript.Script(), sigHashes, wdb); err != nil {
+				return fmt.Errorf("couldn't sign the input %d with the public key script %s: %w", i, txin.ScriptPubKey, err)
+			}
+
+			continue
+		}
+
+		// Find the WIF corresponding to the public key script from the WIF list in the input
+		wif, err := wdb.find(prevPubKeyScript)
+		if err != nil {
+			return fmt.Errorf("couldn't sign the input %d with the public key script %s: %w", i, txin.ScriptPubKey, err)
 		}
 
-		// Find the WIF corresponding to the above PubKey hash from the WIF list in the input
-		wif, ok := wdb[hex.EncodeToString(pubKeyHash)]
-		if !ok {
-			return fmt.Errorf("couldn't find WIF corresponding to the public key script %s in given WIFs", txin.ScriptPubKey)
+		switch prevPubKeyScript.Class() {
+		case txscript.PubKeyHashTy:
+			err = signP2PKH(t, i, prevPubKeyScript.Script(), wif)
+		case txscript.WitnessV0PubKeyHashTy:
+			if txin.Value <= 0 {
+				return fmt.Errorf("couldn't sign the input %d: %w", i, errNoValue)
+			}
+
+			err = signP2WPKH(t, i, prevPubKeyScript.Script(), txin.Value, sigHashes, wif)
+		case txscript.ScriptHashTy:
+			if txin.Value <= 0 {
+				return fmt.Errorf("couldn't sign the input %d: %w", i, errNoValue)
+			}
+
+			err = signP2SHP2WPKH(t, i, prevPubKeyScript.Script(), txin.Value, sigHashes, wif)
+		case txscript.WitnessV1TaprootTy:
+			err = signP2TR(t, i, prevPubKeyScript.Script(), txin.Value, sigHashes, wif)
+		default:
+			err = fmt.Errorf("unsupported public key script type: %s", prevPubKeyScript.Class())
 		}
 
-		// Construct a signature
-		signature, err := txscript.SignatureScript(t, i, prevPubKeyScriptBytes, txscript.SigHashAll, wif.PrivKey, false)
 		if err != nil {
-			return fmt.Errorf("couldn't generate a signature for the tx: %w", err)
+			return fmt.Errorf("couldn't sign the input %d with the public key script %s: %w", i, txin.ScriptPubKey, err)
 		}
+	}
+
+	return nil
+}
 
-		// Add the constructed signature to the corresponding TxIn
-		t.TxIn[i].SignatureScript = signature
+func signP2PKH(t *wire.MsgTx, idx int, prevPubKeyScript []byte, wif *btcutil.WIF) error {
+	// Construct a signature
+	signature, err := txscript.SignatureScript(t, idx, prevPubKeyScript, txscript.SigHashAll, wif.PrivKey, wif.CompressPubKey)
+	if err != nil {
+		return fmt.Errorf("couldn't generate a signature for the tx: %w", err)
+	}
+
+	// Add the constructed signature to the corresponding TxIn
+	t.TxIn[idx].SignatureScript = signature
+
+	return nil
+}
+
+func signP2WPKH(t *wire.MsgTx, idx int, prevPubKeyScript []byte, value int64, sigHashes *txscript.TxSigHashes, wif *btcutil.WIF) error {
+	// Construct a witness; the script code for P2WPKH is derived from the witness program
+	witness, err := txscript.WitnessSignature(t, sigHashes, idx, value, prevPubKeyScript, txscript.SigHashAll, wif.PrivKey, true)
+	if err != nil {
+		return fmt.Errorf("couldn't generate a witness for the tx: %w", err)
+	}
+
+	// Add the constructed witness to the corresponding TxIn
+	t.TxIn[idx].Witness = witness
+
+	return nil
+}
+
+func signP2SHP2WPKH(t *wire.MsgTx, idx int, prevPubKeyScript []byte, value int64, sigHashes *txscript.TxSigHashes, wif *btcutil.WIF) error {
+	redeemScript, err := mybtcwif.NestedWitnessRedeemScript(wif)
+	if err != nil {
+		return fmt.Errorf("couldn't generate a redeem script: %w", err)
+	}
+
+	// Construct a witness; the script code is derived from the redeem script (the witness program)
+	witness, err := txscript.WitnessSignature(t, sigHashes, idx, value, redeemScript, txscript.SigHashAll, wif.PrivKey, true)
+	if err != nil {
+		return fmt.Errorf("couldn't generate a witness for the tx: %w", err)
+	}
+
+	// The signature script only pushes the redeem script
+	sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+	if err != nil {
+		return fmt.Errorf("couldn't build a signature script: %w", err)
+	}
+
+	// Add the constructed signature script and witness to the corresponding TxIn
+	t.TxIn[idx].SignatureScript = sigScript
+	t.TxIn[idx].Witness = witness
+
+	return nil
+}
+
+func signP2TR(t *wire.MsgTx, idx int, prevPubKeyScript []byte, value int64, sigHashes *txscript.TxSigHashes, wif *btcutil.WIF) error {
+	// Construct a key-path witness; the private key is tweaked with the empty script tree inside
+	witness, err := txscript.TaprootWitnessSignature(t, sigHashes, idx, value, prevPubKeyScript, txscript.SigHashDefault, wif.PrivKey)
+	if err != nil {
+		return fmt.Errorf("couldn't generate a witness for the tx: %w", err)
+	}
+
+	// Add the constructed witness to the corresponding TxIn
+	t.TxIn[idx].Witness = witness
+
+	return nil
+}
+
+// checkTaprootValues ensures that all the values are given when there is at least one taproot input.
+func checkTaprootValues(ins []In, prevPubKeyScripts []txscript.PkScript) error {
+	hasTaproot := false
+
+	for _, s := range prevPubKeyScripts {
+		if s.Class() == txscript.WitnessV1TaprootTy {
+			hasTaproot = true
+
+			break
+		}
+	}
+
+	if !hasTaproot {
+		return nil
+	}
+
+	for i, txin := range ins {
+		if txin.Value <= 0 {
+			return fmt.Errorf("couldn't sign the input %d: %w", i, errNoAllValue)
+		}
 	}
 
 	return nil
@@ -197,3 +518,31 @@ func extractPubKeyHash(script []byte) []byte {
 
 	return nil
 }
+
+// extractWitnessPubKeyHash extracts the PubKey hash from a P2WPKH script of OP_0 <20-byte hash>.
+func extractWitnessPubKeyHash(script []byte) []byte {
+	if len(script) == 22 && script[0] == txscript.OP_0 && script[1] == txscript.OP_DATA_20 {
+		return script[2:22]
+	}
+
+	return nil
+}
+
+// extractScriptHash extracts the script hash from a P2SH script of OP_HASH160 <20-byte hash> OP_EQUAL.
+func extractScriptHash(script []byte) []byte {
+	if len(script) == 23 &&
+		script[0] == txscript.OP_HASH160 && script[1] == txscript.OP_DATA_20 && script[22] == txscript.OP_EQUAL {
+		return script[2:22]
+	}
+
+	return nil
+}
+
+// extractTaprootOutputKey extracts the x-only output key from a P2TR script of OP_1 <32-byte key>.
+func extractTaprootOutputKey(script []byte) []byte {
+	if len(script) == 34 && script[0] == txscript.OP_1 && script[1] == txscript.OP_DATA_32 {
+		return script[2:34]
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package tx
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var errNoInForTxIn = errors.New("the previous output is not in the ins")
+
+// VerifyResult is the result of running the scripts of a TxIn.
+// Opcode is the disassembled opcode which failed, and it is empty if the failure is not at any opcode.
+type VerifyResult struct {
+	Index    int    `json:"index"`
+	OutPoint string `json:"outpoint"`
+	OK       bool   `json:"ok"`
+	Opcode   string `json:"opcode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Verify runs the signature script and the witness of every input of the raw transaction in hex through the script engine
+// against the previous outputs given as ins, which are found by their outpoints.
+// Values of ins are required for SegWit inputs, and for every input when any of them spends a taproot output.
+func Verify(rawTx string, ins []In) ([]VerifyResult, error) {
+	msgTx, err := decodeMsgTx(strings.TrimSpace(rawTx))
+	if err != nil {
+		return nil, err
+	}
+
+	prevOuts := map[wire.OutPoint]*wire.TxOut{}
+
+	for _, txin := range ins {
+		hash, err := chainhash.NewHashFromStr(txin.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse the txid %s: %w", txin.TxID, err)
+		}
+
+		script, err := hex.DecodeString(txin.ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't decode the previous public key script: %w", err)
+		}
+
+		prevOuts[*wire.NewOutPoint(hash, txin.Vout)] = wire.NewTxOut(txin.Value, script)
+	}
+
+	for _, txIn := range msgTx.TxIn {
+		if _, ok := prevOuts[txIn.PreviousOutPoint]; !ok {
+			return nil, fmt.Errorf("%w: %s", errNoInForTxIn, txIn.PreviousOutPoint)
+		}
+	}
+
+	prevOutFetcher := txscript.NewMultiPrevOutFetcher(prevOuts)
+	sigHashes := txscript.NewTxSigHashes(msgTx, prevOutFetcher)
+	results := make([]VerifyResult, 0, len(msgTx.TxIn))
+
+	for i, txIn := range msgTx.TxIn {
+		r := VerifyResult{Index: i, OutPoint: txIn.PreviousOutPoint.String(), OK: true}
+
+		if opcode, err := verifyTxIn(msgTx, i, prevOuts[txIn.PreviousOutPoint], sigHashes, prevOutFetcher); err != nil {
+			r.OK = false
+			r.Opcode = opcode
+			r.Error = err.Error()
+		}
+
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// verifyTxIn executes the scripts of the TxIn step by step, and returns the opcode at which it fails.
+func verifyTxIn(t *wire.MsgTx, idx int, prevOut *wire.TxOut, sigHashes *txscript.TxSigHashes,
+	prevOutFetcher txscript.PrevOutputFetcher,
+) (string, error) {
+	vm, err := txscript.NewEngine(prevOut.PkScript, t, idx, txscript.StandardVerifyFlags, nil,
+		sigHashes, prevOut.Value, prevOutFetcher)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create a script engine: %w", err)
+	}
+
+	for done := false; !done; {
+		// e.g. "01:0004: OP_CHECKSIG" for the fifth opcode of the public key script
+		opcode, _ := vm.DisasmPC()
+
+		if done, err = vm.Step(); err != nil {
+			return opcode, err
+		}
+	}
+
+	// The stack must end with true
+	if err := vm.CheckErrorCondition(true); err != nil {
+		return "", err
+	}
+
+	return "", nil
+}
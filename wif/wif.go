@@ -1,32 +1,54 @@
 /*
 Package wif handles WIFs
 
-- New generates new WIF
-- ExtractAddress extract the address from WIF
+- New generates new WIF for a compressed or uncompressed public key
+- ExtractAddr extracts the P2PKH, P2SH-P2WPKH, P2WPKH or P2TR address from WIF
+- Inspect describes the keys and the addresses of WIF
 */
 package wif
 
 import (
-	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/btcsuite/btcd/txscript"
 )
 
-// New will construct a new WIF object with the given random generator.
-func New(r io.Reader) (string, error) {
-	key, err := ecdsa.GenerateKey(btcec.S256(), r)
+// AddrType expresses a type of addresses derived from a WIF.
+type AddrType string
+
+const (
+	// AddrTypeP2PKH is the type of legacy pay-to-pubkey-hash addresses.
+	AddrTypeP2PKH AddrType = "p2pkh"
+	// AddrTypeP2SHP2WPKH is the type of P2WPKH addresses nested in P2SH (BIP49).
+	AddrTypeP2SHP2WPKH AddrType = "p2sh-p2wpkh"
+	// AddrTypeP2WPKH is the type of native SegWit v0 addresses (BIP84).
+	AddrTypeP2WPKH AddrType = "p2wpkh"
+	// AddrTypeP2TR is the type of taproot addresses with the key-path only (BIP86).
+	AddrTypeP2TR AddrType = "p2tr"
+)
+
+var (
+	errUncompressedSegWit = errors.New("SegWit addresses need a WIF for a compressed public key")
+	errWrongNetwork       = errors.New("the WIF is not for the network")
+)
+
+// New will construct a new WIF object for the network with the given random generator.
+// The WIF is for the compressed public key if compress is true.
+func New(r io.Reader, net *chaincfg.Params, compress bool) (string, error) {
+	pk, err := newPrivKey(r)
 	if err != nil {
 		return "", fmt.Errorf("couldn't generate a private key: %w", err)
 	}
 
-	pk := secp256k1.PrivKeyFromBytes(key.D.Bytes())
-
-	wif, err := btcutil.NewWIF(pk, &chaincfg.TestNet3Params, false)
+	wif, err := btcutil.NewWIF(pk, net, compress)
 	if err != nil {
 		return "", fmt.Errorf("couldn't create a wif key: %w", err)
 	}
@@ -34,19 +56,184 @@ func New(r io.Reader) (string, error) {
 	return wif.String(), nil
 }
 
-// ExtractAddr extracts the address from the given WIF.
-func ExtractAddr(s string) (string, error) {
+// Decode decodes the given WIF and checks that it is for the network.
+func Decode(s string, net *chaincfg.Params) (*btcutil.WIF, error) {
 	wif, err := btcutil.DecodeWIF(s)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse given WIF: %w", err)
+		return nil, fmt.Errorf("failed to parse given WIF: %w", err)
+	}
+
+	if !wif.IsForNet(net) {
+		return nil, fmt.Errorf("%w: %s", errWrongNetwork, net.Name)
+	}
+
+	return wif, nil
+}
+
+// newPrivKey generates a private key from the random generator in the same way as ecdsa.GenerateKey of Go 1.19,
+// so that the same generator results in the same key regardless of the Go version.
+func newPrivKey(r io.Reader) (*btcec.PrivateKey, error) {
+	params := btcec.S256().Params()
+
+	b := make([]byte, params.N.BitLen()/8+8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("couldn't read random bytes: %w", err)
+	}
+
+	// k is in [1, N-1]
+	one := big.NewInt(1)
+	k := new(big.Int).SetBytes(b)
+	k.Mod(k, new(big.Int).Sub(params.N, one))
+	k.Add(k, one)
+
+	pk, _ := btcec.PrivKeyFromBytes(k.FillBytes(make([]byte, 32)))
+
+	return pk, nil
+}
+
+// ExtractAddr extracts the address of the given type on the network from the given WIF.
+func ExtractAddr(s string, t AddrType, net *chaincfg.Params) (string, error) {
+	wif, err := Decode(s, net)
+	if err != nil {
+		return "", err
 	}
 
-	pubkey := wif.PrivKey.PubKey().SerializeUncompressed()
+	switch t {
+	case AddrTypeP2PKH:
+		return extractP2PKHAddr(wif, net)
+	case AddrTypeP2SHP2WPKH:
+		return extractP2SHP2WPKHAddr(wif, net)
+	case AddrTypeP2WPKH:
+		return extractP2WPKHAddr(wif, net)
+	case AddrTypeP2TR:
+		return extractP2TRAddr(wif, net)
+	default:
+		return "", fmt.Errorf("unknown address type: %s", t)
+	}
+}
 
-	addr, err := btcutil.NewAddressPubKey(pubkey, &chaincfg.TestNet3Params)
+func extractP2PKHAddr(wif *btcutil.WIF, net *chaincfg.Params) (string, error) {
+	// The serialization of the public key follows the WIF
+	pubkey := wif.SerializePubKey()
+
+	addr, err := btcutil.NewAddressPubKey(pubkey, net)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate an address with pubkey %s: %w", pubkey, err)
+		return "", fmt.Errorf("failed to generate an address with pubkey %x: %w", pubkey, err)
 	}
 
 	return addr.EncodeAddress(), nil
 }
+
+func extractP2SHP2WPKHAddr(wif *btcutil.WIF, net *chaincfg.Params) (string, error) {
+	if !wif.CompressPubKey {
+		return "", errUncompressedSegWit
+	}
+
+	redeemScript, err := NestedWitnessRedeemScript(wif)
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := btcutil.NewAddressScriptHash(redeemScript, net)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate an address with redeem script %x: %w", redeemScript, err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+func extractP2WPKHAddr(wif *btcutil.WIF, net *chaincfg.Params) (string, error) {
+	if !wif.CompressPubKey {
+		return "", errUncompressedSegWit
+	}
+
+	pubKeyHash := btcutil.Hash160(wif.PrivKey.PubKey().SerializeCompressed())
+
+	addr, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, net)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate an address with pubkey hash %x: %w", pubKeyHash, err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+func extractP2TRAddr(wif *btcutil.WIF, net *chaincfg.Params) (string, error) {
+	// The output key is the internal key tweaked with an empty script tree
+	taprootKey := txscript.ComputeTaprootKeyNoScript(wif.PrivKey.PubKey())
+
+	addr, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(taprootKey), net)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate an address with taproot key %x: %w", schnorr.SerializePubKey(taprootKey), err)
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// Info describes a WIF.
+type Info struct {
+	Network            string `json:"network"`
+	Compressed         bool   `json:"compressed"`
+	PrivKey            string `json:"privkey"`
+	CompressedPubKey   string `json:"compressed_pubkey"`
+	UncompressedPubKey string `json:"uncompressed_pubkey"`
+	Hash160            string `json:"hash160"`
+	P2PKHAddr          string `json:"p2pkh"`
+	P2WPKHAddr         string `json:"p2wpkh,omitempty"`
+	P2SHP2WPKHAddr     string `json:"p2sh_p2wpkh,omitempty"`
+	P2TRAddr           string `json:"p2tr"`
+}
+
+// Inspect decodes the WIF for the network and describes its keys and addresses.
+// Hash160 is of the public key encoded as the compression flag of the WIF, and SegWit v0 addresses are left empty for uncompressed public keys.
+func Inspect(s string, net *chaincfg.Params) (*Info, error) {
+	wif, err := Decode(s, net)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey := wif.SerializePubKey()
+	info := &Info{
+		Network:            net.Name,
+		Compressed:         wif.CompressPubKey,
+		PrivKey:            hex.EncodeToString(wif.PrivKey.Serialize()),
+		CompressedPubKey:   hex.EncodeToString(wif.PrivKey.PubKey().SerializeCompressed()),
+		UncompressedPubKey: hex.EncodeToString(wif.PrivKey.PubKey().SerializeUncompressed()),
+		Hash160:            hex.EncodeToString(btcutil.Hash160(pubKey)),
+	}
+
+	if info.P2PKHAddr, err = extractP2PKHAddr(wif, net); err != nil {
+		return nil, err
+	}
+
+	if info.P2TRAddr, err = extractP2TRAddr(wif, net); err != nil {
+		return nil, err
+	}
+
+	if !wif.CompressPubKey {
+		return info, nil
+	}
+
+	if info.P2WPKHAddr, err = extractP2WPKHAddr(wif, net); err != nil {
+		return nil, err
+	}
+
+	if info.P2SHP2WPKHAddr, err = extractP2SHP2WPKHAddr(wif, net); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// NestedWitnessRedeemScript returns the P2SH-P2WPKH redeem script of the given WIF,
+// which is the P2WPKH witness program for its compressed public key.
+func NestedWitnessRedeemScript(wif *btcutil.WIF) ([]byte, error) {
+	pubKeyHash := btcutil.Hash160(wif.PrivKey.PubKey().SerializeCompressed())
+
+	// The witness program doesn't depend on the network
+	redeemScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pubKeyHash).Script()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate a witness program for pubkey hash %x: %w", pubKeyHash, err)
+	}
+
+	return redeemScript, nil
+}